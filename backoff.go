@@ -0,0 +1,89 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// BackoffPolicy 指数退避重试策略
+type BackoffPolicy struct {
+	MaxAttempts     int                  `json:"maxAttempts"`     // 最多执行次数(含第一次),小于1 时按1处理
+	InitialInterval time.Duration        `json:"initialInterval"` // 第一次重试前的等待时间
+	MaxInterval     time.Duration        `json:"maxInterval"`     // 等待时间上限,0 表示不限制
+	Multiplier      float64              `json:"multiplier"`      // 每次重试等待时间的倍数,小于1 时按1处理
+	Jitter          float64              `json:"jitter"`          // 等待时间随机浮动的比例(0~1),避免并发重试同时发生
+	Retryable       func(err error) bool `json:"-"`               // 判断错误是否可重试,为nil 时使用 IsNetworkError
+}
+
+// DefaultBackoffPolicy 默认连接重试策略:网络错误最多尝试3次,间隔100ms、200ms
+var DefaultBackoffPolicy = BackoffPolicy{
+	MaxAttempts:     3,
+	InitialInterval: 100 * time.Millisecond,
+	MaxInterval:     2 * time.Second,
+	Multiplier:      2,
+}
+
+// Do 执行fn,可重试的错误按退避间隔重试,ctx 取消时立即返回
+func (p BackoffPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsNetworkError
+	}
+	return p.do(ctx, fn, func(err error, attempt int) bool {
+		return attempt < p.MaxAttempts && retryable(err)
+	})
+}
+
+// do 执行fn 直到成功或 shouldRetry 返回false,attempt 为已执行次数;fn 的ctx 中记录当前是第几次执行
+func (p BackoffPolicy) do(ctx context.Context, fn func(ctx context.Context) error, shouldRetry func(err error, attempt int) bool) (err error) {
+	multiplier := max(p.Multiplier, 1)
+	interval := p.InitialInterval
+	for attempt := 1; ; attempt++ {
+		err = fn(withAttempt(ctx, attempt))
+		if err == nil || !shouldRetry(err, attempt) {
+			return err
+		}
+		timer := time.NewTimer(p.jitter(interval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.WithMessagef(err, "retry canceled:%s", ctx.Err())
+		case <-timer.C:
+		}
+		interval = time.Duration(float64(interval) * multiplier)
+		if p.MaxInterval > 0 && interval > p.MaxInterval {
+			interval = p.MaxInterval
+		}
+	}
+}
+
+// jitter 在 interval 上下浮动 Jitter 比例
+func (p BackoffPolicy) jitter(interval time.Duration) time.Duration {
+	jitter := min(max(p.Jitter, 0), 1)
+	if jitter == 0 {
+		return interval
+	}
+	return time.Duration(float64(interval) * (1 + jitter*(2*rand.Float64()-1)))
+}
+
+// IsNetworkError 是否为网络错误(连接失败、连接断开、网络超时等),这类错误重试可能成功;
+// ctx 取消、超时(context.DeadlineExceeded 同样实现了 net.Error)不是网络错误
+func IsNetworkError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
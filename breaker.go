@@ -0,0 +1,348 @@
+package sqlexec
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/logchan/v2"
+)
+
+// ErrCircuitOpen 熔断器打开,语句未发送到数据库,详细信息见 *CircuitOpenError
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitOpenError 熔断器打开时返回
+type CircuitOpenError struct {
+	DBName     string
+	State      CircuitState
+	RetryAfter time.Duration // 距离进入半开状态的时间,半开状态探测名额已满时为0
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: db %s, state %s, retry after %s", ErrCircuitOpen.Error(), e.DBName, e.State, e.RetryAfter)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitState 熔断器状态
+type CircuitState string
+
+const (
+	CircuitState_Closed   CircuitState = "closed"    // 正常放行
+	CircuitState_Open     CircuitState = "open"      // 直接返回 ErrCircuitOpen
+	CircuitState_HalfOpen CircuitState = "half_open" // 放行少量探测语句,成功后关闭,失败重新打开
+)
+
+// CircuitBreakerConfig 熔断器配置,零值字段使用 DefaultCircuitBreakerConfig 的值
+type CircuitBreakerConfig struct {
+	Window         time.Duration        `json:"window"`         // 统计窗口(固定窗口),默认10s
+	MinRequests    int                  `json:"minRequests"`    // 窗口内语句数达到该值后才判断是否打开,默认20
+	ErrorRate      float64              `json:"errorRate"`      // 失败比例阈值(0~1),默认0.5
+	SlowThreshold  time.Duration        `json:"slowThreshold"`  // 耗时超过该值记为慢调用,0 不统计
+	SlowRate       float64              `json:"slowRate"`       // 慢调用比例阈值(0~1),0 不按慢调用打开
+	OpenTimeout    time.Duration        `json:"openTimeout"`    // 打开后进入半开状态的时间,默认30s
+	HalfOpenProbes int                  `json:"halfOpenProbes"` // 半开状态放行的探测语句数,全部成功后关闭,默认1
+	IsFailure      func(err error) bool `json:"-"`              // 判断错误是否计入失败,默认为连接错误和超时,唯一键冲突等业务错误不计入
+}
+
+// DefaultCircuitBreakerConfig 默认熔断器配置
+var DefaultCircuitBreakerConfig = CircuitBreakerConfig{
+	Window:         10 * time.Second,
+	MinRequests:    20,
+	ErrorRate:      0.5,
+	OpenTimeout:    30 * time.Second,
+	HalfOpenProbes: 1,
+}
+
+// IsCircuitFailure 默认的失败判断:连接错误及语句超时
+func IsCircuitFailure(err error) bool {
+	err = ClassifyError(err, "", "")
+	return errors.Is(err, ErrConnection) || errors.Is(err, ErrQueryTimeout)
+}
+
+const (
+	LOG_INFO_CIRCUIT_BREAKER LogName = "LogInfoCircuitBreaker"
+)
+
+// LogInfoCircuitBreaker 熔断器状态变化日志
+type LogInfoCircuitBreaker struct {
+	DBName   string       `json:"dbName"`
+	From     CircuitState `json:"from"`
+	To       CircuitState `json:"to"`
+	Reason   string       `json:"reason"`
+	Requests int          `json:"requests"` // 触发打开时窗口内的语句数
+	Failures int          `json:"failures"`
+	Slow     int          `json:"slow"`
+	At       time.Time    `json:"at"`
+	logchan.EmptyLogInfo
+}
+
+func (l *LogInfoCircuitBreaker) GetName() logchan.LogName {
+	return LOG_INFO_CIRCUIT_BREAKER
+}
+
+func (l *LogInfoCircuitBreaker) GetLevel() string {
+	if l.To == CircuitState_Open {
+		return "warn"
+	}
+	return "info"
+}
+
+// circuitBreaker 单个 executor 的熔断器
+type circuitBreaker struct {
+	config      CircuitBreakerConfig
+	dbName      func() string
+	mu          sync.Mutex
+	state       CircuitState
+	generation  uint64 // 每次状态变化加1,忽略状态变化前放行的语句结果
+	windowStart time.Time
+	requests    int
+	failures    int
+	slow        int
+	openedAt    time.Time
+	probes      int // 半开状态已放行的探测语句数
+	successes   int // 半开状态成功的探测语句数
+}
+
+func newCircuitBreaker(config CircuitBreakerConfig, dbName func() string) (b *circuitBreaker) {
+	def := DefaultCircuitBreakerConfig
+	if config.Window <= 0 {
+		config.Window = def.Window
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = def.MinRequests
+	}
+	if config.ErrorRate <= 0 {
+		config.ErrorRate = def.ErrorRate
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = def.OpenTimeout
+	}
+	if config.HalfOpenProbes <= 0 {
+		config.HalfOpenProbes = def.HalfOpenProbes
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = IsCircuitFailure
+	}
+	return &circuitBreaker{config: config, dbName: dbName, state: CircuitState_Closed}
+}
+
+// allow 判断语句是否放行,放行时返回当前generation,结束后调用 record
+func (b *circuitBreaker) allow() (generation uint64, err error) {
+	b.mu.Lock()
+	var logInfo *LogInfoCircuitBreaker
+	defer func() {
+		b.mu.Unlock()
+		if logInfo != nil {
+			logchan.SendLogInfo(logInfo)
+		}
+	}()
+	now := time.Now()
+	if b.state == CircuitState_Open {
+		retryAfter := b.openedAt.Add(b.config.OpenTimeout).Sub(now)
+		if retryAfter > 0 {
+			return 0, &CircuitOpenError{DBName: b.dbName(), State: b.state, RetryAfter: retryAfter}
+		}
+		logInfo = b.transition(CircuitState_HalfOpen, "open timeout elapsed", now)
+	}
+	if b.state == CircuitState_HalfOpen {
+		if b.probes >= b.config.HalfOpenProbes {
+			return 0, &CircuitOpenError{DBName: b.dbName(), State: b.state}
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+// record 记录放行语句的结果,状态已变化时忽略
+func (b *circuitBreaker) record(generation uint64, err error, duration time.Duration) {
+	failed := err != nil && b.config.IsFailure(err)
+	slow := b.config.SlowThreshold > 0 && duration >= b.config.SlowThreshold
+	b.mu.Lock()
+	var logInfo *LogInfoCircuitBreaker
+	defer func() {
+		b.mu.Unlock()
+		if logInfo != nil {
+			logchan.SendLogInfo(logInfo)
+		}
+	}()
+	if generation != b.generation {
+		return
+	}
+	now := time.Now()
+	switch b.state {
+	case CircuitState_HalfOpen:
+		switch {
+		case failed:
+			logInfo = b.transition(CircuitState_Open, fmt.Sprintf("probe failed: %s", err), now)
+		case slow && b.config.SlowRate > 0:
+			logInfo = b.transition(CircuitState_Open, fmt.Sprintf("probe slow: %s", duration), now)
+		default:
+			b.successes++
+			if b.successes >= b.config.HalfOpenProbes {
+				logInfo = b.transition(CircuitState_Closed, "probes succeeded", now)
+			}
+		}
+	case CircuitState_Closed:
+		if now.Sub(b.windowStart) >= b.config.Window {
+			b.windowStart, b.requests, b.failures, b.slow = now, 0, 0, 0
+		}
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if slow {
+			b.slow++
+		}
+		if b.requests < b.config.MinRequests {
+			return
+		}
+		errorRate := float64(b.failures) / float64(b.requests)
+		slowRate := float64(b.slow) / float64(b.requests)
+		switch {
+		case errorRate >= b.config.ErrorRate:
+			logInfo = b.transition(CircuitState_Open, fmt.Sprintf("error rate %.2f >= %.2f", errorRate, b.config.ErrorRate), now)
+		case b.config.SlowRate > 0 && slowRate >= b.config.SlowRate:
+			logInfo = b.transition(CircuitState_Open, fmt.Sprintf("slow rate %.2f >= %.2f", slowRate, b.config.SlowRate), now)
+		}
+	}
+}
+
+// cancel 放行的语句未执行(如并发限制拒绝),半开状态时归还探测名额
+func (b *circuitBreaker) cancel(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation == b.generation && b.state == CircuitState_HalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// transition 切换状态并重置计数,返回状态变化日志;调用方需持有 b.mu,释放锁后发送日志
+func (b *circuitBreaker) transition(to CircuitState, reason string, now time.Time) (logInfo *LogInfoCircuitBreaker) {
+	logInfo = &LogInfoCircuitBreaker{
+		DBName:   b.dbName(),
+		From:     b.state,
+		To:       to,
+		Reason:   reason,
+		Requests: b.requests,
+		Failures: b.failures,
+		Slow:     b.slow,
+		At:       now.Local(),
+	}
+	b.state = to
+	b.generation++
+	b.windowStart, b.requests, b.failures, b.slow = now, 0, 0, 0
+	b.probes, b.successes = 0, 0
+	if to == CircuitState_Open {
+		b.openedAt = now
+	}
+	return logInfo
+}
+
+// currentState 当前状态,打开超时后仍返回 open,直到下一条语句触发进入半开
+func (b *circuitBreaker) currentState() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// SetCircuitBreaker 开启熔断器:窗口内失败或慢调用比例超过阈值时打开,打开期间语句直接返回 ErrCircuitOpen,超时后半开探测
+func (e *ExecutorSQL) SetCircuitBreaker(config CircuitBreakerConfig) {
+	breaker := newCircuitBreaker(config, e.databaseName)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.breaker = breaker
+}
+
+// CircuitState 熔断器状态,未开启时为空
+func (e *ExecutorSQL) CircuitState() CircuitState {
+	e.mu.Lock()
+	breaker := e.breaker
+	e.mu.Unlock()
+	if breaker == nil {
+		return ""
+	}
+	return breaker.currentState()
+}
+
+const (
+	context_Key_Resilience contextKey = "sqlexec_resilience"
+)
+
+// resilience executor 的并发限制及熔断器,通过ctx 传递给执行语句的函数
+type resilience struct {
+	bulkhead *bulkhead
+	breaker  *circuitBreaker
+}
+
+func (e *ExecutorSQL) withResilience(ctx context.Context) context.Context {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return context.WithValue(ctx, context_Key_Resilience, &resilience{bulkhead: e.bulkhead, breaker: e.breaker}) // 未设置时同样写入,覆盖其它 executor 的设置
+}
+
+// acquireResilience 经过熔断器和并发限制,返回的函数在语句结束时调用;被拒绝时记录到统计。
+// 熔断器只统计发送到数据库的语句,结果由 executeStatement 通过返回的ctx 记录
+func acquireResilience(ctx context.Context) (_ context.Context, done func(), err error) {
+	r, _ := ctx.Value(context_Key_Resilience).(*resilience)
+	if r == nil || (r.bulkhead == nil && r.breaker == nil) {
+		return ctx, func() {}, nil
+	}
+	var call *breakerCall
+	if r.breaker != nil {
+		generation, err := r.breaker.allow()
+		if err != nil {
+			addRejected(ctx)
+			return ctx, nil, err
+		}
+		call = &breakerCall{breaker: r.breaker, generation: generation}
+		ctx = context.WithValue(ctx, context_Key_BreakerCall, call)
+	}
+	release := func() {}
+	if r.bulkhead != nil {
+		release, err = r.bulkhead.acquire(ctx)
+		if err != nil {
+			if call != nil {
+				call.cancel()
+			}
+			addRejected(ctx)
+			return ctx, nil, err
+		}
+	}
+	return ctx, func() {
+		release()
+		if call != nil {
+			call.cancel() // 未发送到数据库(中间件、语句检查拒绝或合并到其它调用的查询)
+		}
+	}, nil
+}
+
+const (
+	context_Key_BreakerCall contextKey = "sqlexec_breaker_call"
+)
+
+// breakerCall 熔断器放行的一次调用,记录结果或归还探测名额只处理先发生的一次
+type breakerCall struct {
+	breaker    *circuitBreaker
+	generation uint64
+	once       sync.Once
+}
+
+func (c *breakerCall) record(err error, duration time.Duration) {
+	c.once.Do(func() { c.breaker.record(c.generation, err, duration) })
+}
+
+func (c *breakerCall) cancel() {
+	c.once.Do(func() { c.breaker.cancel(c.generation) })
+}
+
+// recordBreaker 语句已发送到数据库,记录结果到放行该语句的熔断器;合并查询时只有执行查询的调用记录一次
+func recordBreaker(ctx context.Context, err error, duration time.Duration) {
+	if call, ok := ctx.Value(context_Key_BreakerCall).(*breakerCall); ok {
+		call.record(err, duration)
+	}
+}
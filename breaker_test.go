@@ -0,0 +1,171 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestExecutorSQLCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	var down atomic.Bool
+	server := newFakeServer(t, "root:123@tcp(127.0.0.1:3306)/cb"+t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		if hasPrefixFold(query, "delete") {
+			return nil, errors.New("denied") // 业务错误不计入失败
+		}
+		if down.Load() {
+			return nil, driver.ErrBadConn
+		}
+		return &fakeResponse{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), []byte("a")}}, rowsAffected: 1}, nil
+	})
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: "root:123@tcp(127.0.0.1:3306)/cb" + t.Name()}, nil)
+	executor.SetBackoffPolicy(sqlexec.BackoffPolicy{MaxAttempts: 1})
+	executor.SetCircuitBreaker(sqlexec.CircuitBreakerConfig{MinRequests: 4, ErrorRate: 0.5, OpenTimeout: 50 * time.Millisecond})
+	t.Cleanup(func() { executor.Close() })
+	query := func() error {
+		var out []map[string]string
+		return executor.ExecOrQueryContext(ctx, "select id,name from service", &out)
+	}
+
+	assert.Equal(t, sqlexec.CircuitState_Closed, executor.CircuitState())
+	var rowsAffected int
+	for i := 0; i < 4; i++ {
+		require.Error(t, executor.ExecOrQueryContext(ctx, "delete from service where id=1", &rowsAffected))
+	}
+	assert.Equal(t, sqlexec.CircuitState_Closed, executor.CircuitState())
+
+	down.Store(true)
+	for i := 0; i < 4; i++ {
+		require.Error(t, query())
+	}
+	assert.Equal(t, sqlexec.CircuitState_Open, executor.CircuitState())
+	executed := len(server.Log())
+	err := query()
+	require.ErrorIs(t, err, sqlexec.ErrCircuitOpen)
+	var openErr *sqlexec.CircuitOpenError
+	require.ErrorAs(t, err, &openErr)
+	assert.Equal(t, "cb"+t.Name(), openErr.DBName)
+	assert.Greater(t, openErr.RetryAfter, time.Duration(0))
+	assert.Len(t, server.Log(), executed, "熔断时不执行语句")
+	stats := executor.Stats()
+	assert.Equal(t, uint64(1), stats.Rejected)
+	assert.Equal(t, sqlexec.CircuitState_Open, stats.Circuit)
+
+	time.Sleep(60 * time.Millisecond) // 半开探测失败重新打开
+	require.Error(t, query())
+	assert.Equal(t, sqlexec.CircuitState_Open, executor.CircuitState())
+	assert.ErrorIs(t, query(), sqlexec.ErrCircuitOpen)
+
+	down.Store(false) // 半开探测成功后关闭
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, query())
+	assert.Equal(t, sqlexec.CircuitState_Closed, executor.CircuitState())
+	require.NoError(t, query())
+}
+
+func TestExecutorSQLBulkhead(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	newFakeServer(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		if hasPrefixFold(query, "select blocking") {
+			started <- struct{}{}
+			<-release
+		}
+		return &fakeResponse{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), []byte("a")}}}, nil
+	})
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: t.Name()}, nil)
+	executor.SetBulkhead(sqlexec.BulkheadConfig{MaxConcurrent: 1, MaxWait: 20 * time.Millisecond})
+	t.Cleanup(func() { executor.Close() })
+	query := func(sqls string) error {
+		var out []map[string]string
+		return executor.ExecOrQueryContext(ctx, sqls, &out)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- query("select blocking,name from service")
+	}()
+	<-started
+	err := query("select id,name from service")
+	assert.ErrorIs(t, err, sqlexec.ErrBulkheadFull)
+	assert.Equal(t, uint64(1), executor.Stats().Rejected)
+
+	go func() { // 排队等待期间释放名额
+		time.Sleep(5 * time.Millisecond)
+		close(release)
+	}()
+	assert.NoError(t, query("select id,name from service"))
+	require.NoError(t, <-done)
+}
+
+func TestCircuitBreakerDriverOutcome(t *testing.T) {
+	ctx := context.Background()
+	t.Run("probe rejected before driver", func(t *testing.T) {
+		dsn := "root:123@tcp(127.0.0.1:3306)/cb" + t.Name()
+		var down atomic.Bool
+		down.Store(true)
+		server := newFakeServer(t, dsn, func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+			if down.Load() {
+				return nil, driver.ErrBadConn
+			}
+			return &fakeResponse{columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}}, rowsAffected: 1}, nil
+		})
+		executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: dsn}, nil)
+		executor.SetBackoffPolicy(sqlexec.BackoffPolicy{MaxAttempts: 1})
+		executor.SetCircuitBreaker(sqlexec.CircuitBreakerConfig{MinRequests: 1, OpenTimeout: 30 * time.Millisecond})
+		t.Cleanup(func() { executor.Close() })
+		var out []map[string]string
+		require.Error(t, executor.ExecOrQueryContext(ctx, "select id from service", &out))
+		require.Equal(t, sqlexec.CircuitState_Open, executor.CircuitState())
+
+		time.Sleep(40 * time.Millisecond) // 被语句检查拒绝的探测不改变状态,并归还探测名额
+		executed := len(server.Log())
+		var rowsAffected int
+		readOnly := sqlexec.WithGuardrails(ctx, &sqlexec.GuardrailPolicy{ReadOnly: true})
+		err := executor.ExecOrQueryContext(readOnly, "delete from service where id=1", &rowsAffected)
+		require.ErrorIs(t, err, sqlexec.ErrGuardrail)
+		assert.Len(t, server.Log(), executed)
+		assert.Equal(t, sqlexec.CircuitState_HalfOpen, executor.CircuitState())
+
+		require.Error(t, executor.ExecOrQueryContext(ctx, "select id from service", &out))
+		assert.Equal(t, sqlexec.CircuitState_Open, executor.CircuitState())
+	})
+	t.Run("singleflight records once", func(t *testing.T) {
+		dsn := "root:123@tcp(127.0.0.1:3306)/cb" + t.Name()
+		release := make(chan struct{})
+		newFakeServer(t, dsn, func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+			<-release
+			return nil, driver.ErrBadConn
+		})
+		executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: dsn}, nil)
+		executor.SetBackoffPolicy(sqlexec.BackoffPolicy{MaxAttempts: 1})
+		executor.SetCircuitBreaker(sqlexec.CircuitBreakerConfig{MinRequests: 2, OpenTimeout: time.Minute})
+		t.Cleanup(func() { executor.Close() })
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var out []map[string]string
+				assert.Error(t, executor.ExecOrQueryContext(ctx, "select id from service", &out))
+			}()
+		}
+		time.Sleep(50 * time.Millisecond) // 等待所有查询合并到同一次执行
+		close(release)
+		wg.Wait()
+		assert.Equal(t, sqlexec.CircuitState_Closed, executor.CircuitState(), "合并的查询只记录一次")
+
+		var out []map[string]string
+		require.Error(t, executor.ExecOrQueryContext(ctx, "select id from service", &out))
+		assert.Equal(t, sqlexec.CircuitState_Open, executor.CircuitState())
+	})
+}
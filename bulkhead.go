@@ -0,0 +1,66 @@
+package sqlexec
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrBulkheadFull 同时执行的语句数达到上限且排队超时,语句未发送到数据库
+var ErrBulkheadFull = errors.New("bulkhead full")
+
+// BulkheadConfig 单个 executor 的并发限制
+type BulkheadConfig struct {
+	MaxConcurrent int           `json:"maxConcurrent"` // 同时执行的语句数上限,小于1 时不限制
+	MaxWait       time.Duration `json:"maxWait"`       // 达到上限后排队等待的时间,0 表示不等待直接返回 ErrBulkheadFull
+}
+
+// bulkhead 信号量,限制同时执行的语句数
+type bulkhead struct {
+	config BulkheadConfig
+	sem    chan struct{}
+}
+
+func newBulkhead(config BulkheadConfig) (b *bulkhead) {
+	if config.MaxConcurrent < 1 {
+		return nil
+	}
+	return &bulkhead{config: config, sem: make(chan struct{}, config.MaxConcurrent)}
+}
+
+// acquire 获取执行名额,成功时返回释放函数;排队超时返回 ErrBulkheadFull,ctx 取消时返回 ctx.Err()
+func (b *bulkhead) acquire(ctx context.Context) (release func(), err error) {
+	release = func() { <-b.sem }
+	select {
+	case b.sem <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if b.config.MaxWait <= 0 {
+		return nil, errors.WithMessagef(ErrBulkheadFull, "max concurrent:%d", b.config.MaxConcurrent)
+	}
+	timer := time.NewTimer(b.config.MaxWait)
+	defer timer.Stop()
+	select {
+	case b.sem <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, errors.WithMessagef(ErrBulkheadFull, "max concurrent:%d,wait:%s", b.config.MaxConcurrent, b.config.MaxWait)
+	}
+}
+
+// inUse 正在执行的语句数
+func (b *bulkhead) inUse() int {
+	return len(b.sem)
+}
+
+// SetBulkhead 限制通过该 executor 同时执行的语句数,MaxConcurrent 小于1 时取消限制;
+// 建议不超过 DBConfig.MaxOpen,避免调用方阻塞在连接池上
+func (e *ExecutorSQL) SetBulkhead(config BulkheadConfig) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.bulkhead = newBulkhead(config)
+}
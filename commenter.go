@@ -0,0 +1,147 @@
+package sqlexec
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/suifengpiao14/sqlexec/sqlexecparser"
+)
+
+const (
+	context_Key_SQLCommenter contextKey = "sqlexec_sql_commenter"
+	context_Key_CommentTags  contextKey = "sqlexec_comment_tags"
+)
+
+// 常用的注释标签
+const (
+	CommentKey_Service     = "service"
+	CommentKey_Route       = "route"
+	CommentKey_TraceParent = "traceparent" // W3C traceparent,见 otelsqlexec.TraceParent
+	CommentKey_RequestID   = "request_id"
+)
+
+// CommentExtractor 从ctx 获取标签值,返回空字符串时不添加该标签
+type CommentExtractor func(ctx context.Context) (value string)
+
+// SQLCommenter 执行前在语句末尾追加 sqlcommenter 格式的注释 /*key='value',...*/,
+// 方便在 processlist、慢日志中定位发起语句的服务、路由、链路
+type SQLCommenter struct {
+	mu         sync.RWMutex
+	extractors map[string]CommentExtractor
+}
+
+func NewSQLCommenter() (c *SQLCommenter) {
+	return &SQLCommenter{extractors: make(map[string]CommentExtractor)}
+}
+
+// Register 注册标签,key 已存在时替换
+func (c *SQLCommenter) Register(key string, extractor CommentExtractor) *SQLCommenter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.extractors[key] = extractor
+	return c
+}
+
+// RegisterValue 注册固定值的标签,如服务名
+func (c *SQLCommenter) RegisterValue(key string, value string) *SQLCommenter {
+	return c.Register(key, func(ctx context.Context) string { return value })
+}
+
+// WithCommentTag 设置本次调用的注释标签,优先级高于注册的同名标签,需要 executor 开启 SQLCommenter
+func WithCommentTag(ctx context.Context, key string, value string) context.Context {
+	parent, _ := ctx.Value(context_Key_CommentTags).(map[string]string)
+	tags := make(map[string]string, len(parent)+1)
+	for k, v := range parent {
+		tags[k] = v
+	}
+	tags[key] = value
+	return context.WithValue(ctx, context_Key_CommentTags, tags)
+}
+
+// Tags 从ctx 获取所有非空标签
+func (c *SQLCommenter) Tags(ctx context.Context) (tags map[string]string) {
+	tags = make(map[string]string)
+	c.mu.RLock()
+	for key, extractor := range c.extractors {
+		if value := extractor(ctx); value != "" {
+			tags[key] = value
+		}
+	}
+	c.mu.RUnlock()
+	ctxTags, _ := ctx.Value(context_Key_CommentTags).(map[string]string)
+	for key, value := range ctxTags {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+	return tags
+}
+
+// Comment 按 sqlcommenter 规范生成注释:key 排序,key、value 经过 url 编码,value 用单引号包裹;没有标签时返回空
+func (c *SQLCommenter) Comment(ctx context.Context) (comment string) {
+	return FormatSQLComment(c.Tags(ctx))
+}
+
+// FormatSQLComment 按 sqlcommenter 规范生成注释,编码后不含引号和 */,不会提前结束注释
+func FormatSQLComment(tags map[string]string) (comment string) {
+	if len(tags) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(tags))
+	for key, value := range tags {
+		pairs = append(pairs, commentEscape(key)+"='"+commentEscape(value)+"'")
+	}
+	sort.Strings(pairs)
+	return "/*" + strings.Join(pairs, ",") + "*/"
+}
+
+func commentEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// AppendSQLComment 在语句末尾(结尾的分号之前)追加注释;最后一行有单行注释时换行追加,避免被注释掉
+func AppendSQLComment(sqls string, comment string) string {
+	if comment == "" {
+		return sqls
+	}
+	trimmed := strings.TrimRight(sqls, " \t\r\n;")
+	suffix := ""
+	if strings.TrimSpace(sqls[len(trimmed):]) != "" {
+		suffix = ";"
+	}
+	separator := " "
+	if sqlexecparser.EndsWithLineComment(trimmed) {
+		separator = "\n"
+	}
+	return trimmed + separator + comment + suffix
+}
+
+// WithSQLCommenter 设置本次调用使用的 SQLCommenter,优先级高于 ExecutorSQL.SetSQLCommenter
+func WithSQLCommenter(ctx context.Context, commenter *SQLCommenter) context.Context {
+	return context.WithValue(ctx, context_Key_SQLCommenter, commenter)
+}
+
+func sqlCommenterFromContext(ctx context.Context) (commenter *SQLCommenter, ok bool) {
+	commenter, ok = ctx.Value(context_Key_SQLCommenter).(*SQLCommenter)
+	return commenter, ok
+}
+
+// withSQLComment 返回实际发送给数据库的语句;语法解析、singleflight key、日志均使用原语句,
+// 合并查询时共享结果的调用方使用首个调用方的注释
+func withSQLComment(ctx context.Context, sqls string) string {
+	commenter, ok := sqlCommenterFromContext(ctx)
+	if !ok || commenter == nil {
+		return sqls
+	}
+	return AppendSQLComment(sqls, commenter.Comment(ctx))
+}
+
+// SetSQLCommenter 开启语句注释,nil 表示关闭;单次调用可通过 WithSQLCommenter 覆盖
+func (e *ExecutorSQL) SetSQLCommenter(commenter *SQLCommenter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sqlCommenter = commenter
+}
@@ -0,0 +1,92 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+type requestIDKey struct{}
+
+func TestSQLCommenter(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	server := newFakeServer(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		if hasPrefixFold(query, "select blocking") {
+			<-release
+		}
+		return &fakeResponse{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), []byte("a")}}, rowsAffected: 1}, nil
+	})
+	commenter := sqlexec.NewSQLCommenter().
+		RegisterValue(sqlexec.CommentKey_Service, "order api").
+		Register(sqlexec.CommentKey_RequestID, func(ctx context.Context) string {
+			id, _ := ctx.Value(requestIDKey{}).(string)
+			return id
+		})
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: t.Name()}, nil)
+	executor.SetSQLCommenter(commenter)
+	t.Cleanup(func() { executor.Close() })
+
+	reqCtx := sqlexec.WithCommentTag(context.WithValue(ctx, requestIDKey{}, "r'1"), sqlexec.CommentKey_Route, "/orders/{id}")
+	var out []map[string]string
+	require.NoError(t, executor.ExecOrQueryContext(reqCtx, "select id,name from service;", &out))
+	var rowsAffected int
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "update service set name='a' where id=1 -- note", &rowsAffected))
+	log := server.Log()
+	require.Len(t, log, 2)
+	assert.Equal(t, "select id,name from service /*request_id='r%271',route='%2Forders%2F%7Bid%7D',service='order%20api'*/;", log[0])
+	assert.Equal(t, "update service set name='a' where id=1 -- note\n/*service='order%20api'*/", log[1])
+	stmt, err := sqlexec.ParseStatement(log[0])
+	require.NoError(t, err)
+	assert.NotNil(t, stmt.AST)
+
+	t.Run("singleflight key", func(t *testing.T) { // 注释不同的相同查询仍然合并
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				var out []map[string]string
+				ctx := context.WithValue(ctx, requestIDKey{}, string(rune('a'+i)))
+				assert.NoError(t, executor.ExecOrQueryContext(ctx, "select blocking,name from service", &out))
+			}(i)
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		assert.Len(t, server.Log(), 3)
+	})
+	t.Run("disabled", func(t *testing.T) {
+		require.NoError(t, executor.ExecOrQueryContext(sqlexec.WithSQLCommenter(ctx, nil), "select id,name from service", &out))
+		log := server.Log()
+		assert.Equal(t, "select id,name from service", log[len(log)-1])
+	})
+	t.Run("executor setting", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() { // 执行期间修改设置
+			defer close(done)
+			for i := 0; i < 20; i++ {
+				executor.SetSQLCommenter(commenter)
+			}
+		}()
+		for i := 0; i < 20; i++ {
+			require.NoError(t, executor.ExecOrQueryContext(ctx, "select id,name from service", &out))
+		}
+		<-done
+	})
+}
+
+func TestAppendSQLComment(t *testing.T) {
+	comment := sqlexec.FormatSQLComment(map[string]string{"b": "*/ drop", "a": "x"})
+	assert.Equal(t, "/*a='x',b='%2A%2F%20drop'*/", comment)
+	assert.Equal(t, "select 1 "+comment, sqlexec.AppendSQLComment("select 1\n", comment))
+	assert.Equal(t, "select 1 # x\n"+comment+";", sqlexec.AppendSQLComment("select 1 # x ;", comment))
+	assert.Equal(t, "select '#' "+comment, sqlexec.AppendSQLComment("select '#'", comment))
+	assert.Equal(t, "select 1", sqlexec.AppendSQLComment("select 1", ""))
+}
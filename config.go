@@ -0,0 +1,343 @@
+package sqlexec
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DBConfig 数据库配置,DSN 为空时使用 Host 等结构化字段生成 DSN
+type DBConfig struct {
+	DSN                  string            `json:"dsn"`
+	Net                  string            `json:"net"`  // 网络类型,默认tcp
+	Host                 string            `json:"host"` // 主机,与 DSN 二选一
+	Port                 int               `json:"port"` // 端口,默认3306
+	User                 string            `json:"user"`
+	Password             string            `json:"password"`
+	PasswordFile         string            `json:"passwordFile"` // 从文件读取密码(首尾空白会被去掉),与 Password 二选一
+	Database             string            `json:"database"`
+	Charset              string            `json:"charset"`              // 默认utf8mb4
+	Collation            string            `json:"collation"`            // 连接的排序规则
+	Loc                  string            `json:"loc"`                  // 时间值的时区,如 Local、Asia/Shanghai,默认UTC
+	ParseTime            bool              `json:"parseTime"`            // 时间列扫描为 time.Time
+	MultiStatements      bool              `json:"multiStatements"`      // 允许一次执行多条语句
+	ConnectTimeout       int               `json:"connectTimeout"`       // 建立连接超时时间(秒)
+	ReadTimeout          int               `json:"readTimeout"`          // 读超时时间(秒)
+	WriteTimeout         int               `json:"writeTimeout"`         // 写超时时间(秒)
+	TLS                  string            `json:"tls"`                  // true、false、skip-verify、preferred 或 mysql.RegisterTLSConfig 注册的名称
+	Params               map[string]string `json:"params"`               // 其它连接参数(会话变量)
+	LogLevel             string            `json:"logLevel"`             // 日志级别:silent、error、slow、all,默认all
+	SlowThreshold        int               `json:"slowThreshold"`        // 慢语句阈值(毫秒),默认 DefaultSlowThreshold
+	Timeout              int               `json:"timeout"`              // 单条语句超时时间(秒),0 表示不限制
+	MaxExecutionTimeHint bool              `json:"maxExecutionTimeHint"` // 设置了 Timeout 时,select 语句增加 MAX_EXECUTION_TIME 提示
+	MaxOpen              int               `json:"maxOpen"`
+	MaxIdle              int               `json:"maxIdle"`
+	MaxIdleTime          int               `json:"maxIdleTime"`
+	Endpoints            []string          `json:"endpoints"`            // 主库候选DSN,按顺序排在 DSN 之后;主库出现连接级别错误时按顺序探测并切换
+	CheckReadOnly        bool              `json:"checkReadOnly"`        // 探测主库时要求 @@read_only=0
+	ReadOnly             bool              `json:"readOnly"`             // 只读 executor,拒绝所有写语句,见 GuardrailPolicy.ReadOnly
+	Replicas             []string          `json:"replicas"`             // 从库DSN,不加锁的select 语句优先在从库执行
+	ReplicaPolicy        string            `json:"replicaPolicy"`        // 从库选择策略:round_robin、least_conn,默认round_robin
+	ReplicaCheckInterval int               `json:"replicaCheckInterval"` // 从库健康检查间隔(秒),默认 DefaultReplicaCheckInterval
+}
+
+var (
+	ERROR_EMPTY_CONFIG = errors.New("empty db config")
+)
+
+// EnvPrefix 环境变量前缀,EnvToDBConfig 读取 <EnvPrefix>_<NAME>_<FIELD> 格式的变量
+var EnvPrefix = "SQLEXEC"
+
+// JsonToDBConfig 内置将json字符串转为DBConfig
+func JsonToDBConfig(s string) (c *DBConfig, err error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, ERROR_EMPTY_CONFIG
+	}
+	c = &DBConfig{}
+	err = json.Unmarshal([]byte(s), c)
+	if err != nil {
+		return nil, err
+	}
+	err = c.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// YamlToDBConfig 将yaml字符串转为DBConfig,字段名与json 标签相同
+func YamlToDBConfig(s string) (c *DBConfig, err error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, ERROR_EMPTY_CONFIG
+	}
+	var data map[string]any
+	err = yaml.Unmarshal([]byte(s), &data)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return JsonToDBConfig(string(b))
+}
+
+// EnvToDBConfig 从环境变量读取配置,变量名为 SQLEXEC_<NAME>_<FIELD>,FIELD 为json 标签的大写下划线形式,
+// 如 SQLEXEC_MAIN_HOST、SQLEXEC_MAIN_PASSWORD_FILE;params 格式为 k1=v1&k2=v2,replicas、endpoints 多个DSN 用逗号分隔
+func EnvToDBConfig(name string) (c *DBConfig, err error) {
+	prefix := envName(EnvPrefix, name)
+	c = &DBConfig{}
+	found := false
+	rv := reflect.ValueOf(c).Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		key := envName(prefix, tag)
+		val, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+		found = true
+		err = setEnvValue(rv.Field(i), val)
+		if err != nil {
+			err = errors.WithMessagef(err, "env:%s", key)
+			return nil, err
+		}
+	}
+	if !found {
+		err = errors.WithMessagef(ERROR_EMPTY_CONFIG, "env prefix:%s_", prefix)
+		return nil, err
+	}
+	err = c.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// envName 拼接环境变量名,驼峰转为大写下划线,其它非字母数字字符转为下划线
+func envName(parts ...string) string {
+	var w strings.Builder
+	for i, part := range parts {
+		if i > 0 {
+			w.WriteByte('_')
+		}
+		runes := []rune(part)
+		for j, r := range runes {
+			switch {
+			case unicode.IsUpper(r) && j > 0 && unicode.IsLower(runes[j-1]):
+				w.WriteByte('_')
+				w.WriteRune(r)
+			case unicode.IsLetter(r) || unicode.IsDigit(r):
+				w.WriteRune(unicode.ToUpper(r))
+			default:
+				w.WriteByte('_')
+			}
+		}
+	}
+	return w.String()
+}
+
+func setEnvValue(rv reflect.Value, val string) (err error) {
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(val)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil {
+			return err
+		}
+		rv.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(val))
+		if err != nil {
+			return err
+		}
+		rv.SetBool(b)
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() != reflect.String {
+			return errors.Errorf("unsupported kind:%s", rv.Kind())
+		}
+		items := make([]string, 0)
+		for _, item := range strings.Split(val, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+		rv.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		values, err := url.ParseQuery(val)
+		if err != nil {
+			return err
+		}
+		params := make(map[string]string, len(values))
+		for k := range values {
+			params[k] = values.Get(k)
+		}
+		rv.Set(reflect.ValueOf(params))
+	default:
+		return errors.Errorf("unsupported kind:%s", rv.Kind())
+	}
+	return nil
+}
+
+// Validate 检查配置,返回所有不合法的字段
+func (dbConfig DBConfig) Validate() (err error) {
+	msgs := make([]string, 0)
+	addMsg := func(format string, args ...any) {
+		msgs = append(msgs, fmt.Sprintf(format, args...))
+	}
+	switch {
+	case dbConfig.DSN == "" && dbConfig.Host == "" && len(dbConfig.Endpoints) == 0:
+		addMsg("DBConfig.DSN or DBConfig.Host or DBConfig.Endpoints required")
+	case dbConfig.DSN != "" && dbConfig.Host != "":
+		addMsg("DBConfig.DSN and DBConfig.Host are mutually exclusive")
+	case dbConfig.DSN != "" && DriverName == "mysql":
+		if _, err := mysql.ParseDSN(dbConfig.DSN); err != nil {
+			addMsg("DBConfig.DSN invalid:%s", err.Error())
+		}
+	}
+	if dbConfig.Port < 0 || dbConfig.Port > 65535 {
+		addMsg("DBConfig.Port out of range:%d", dbConfig.Port)
+	}
+	if dbConfig.Password != "" && dbConfig.PasswordFile != "" {
+		addMsg("DBConfig.Password and DBConfig.PasswordFile are mutually exclusive")
+	}
+	if dbConfig.PasswordFile != "" {
+		if _, err := os.Stat(dbConfig.PasswordFile); err != nil {
+			addMsg("DBConfig.PasswordFile:%s", err.Error())
+		}
+	}
+	if dbConfig.Loc != "" {
+		if _, err := time.LoadLocation(dbConfig.Loc); err != nil {
+			addMsg("DBConfig.Loc invalid:%s", err.Error())
+		}
+	}
+	if strings.TrimSpace(dbConfig.TLS) != dbConfig.TLS {
+		addMsg("DBConfig.TLS invalid:%q", dbConfig.TLS)
+	}
+	for _, field := range []struct {
+		name string
+		val  int
+	}{
+		{"ConnectTimeout", dbConfig.ConnectTimeout},
+		{"ReadTimeout", dbConfig.ReadTimeout},
+		{"WriteTimeout", dbConfig.WriteTimeout},
+		{"Timeout", dbConfig.Timeout},
+		{"SlowThreshold", dbConfig.SlowThreshold},
+		{"MaxOpen", dbConfig.MaxOpen},
+		{"MaxIdle", dbConfig.MaxIdle},
+		{"MaxIdleTime", dbConfig.MaxIdleTime},
+		{"ReplicaCheckInterval", dbConfig.ReplicaCheckInterval},
+	} {
+		if field.val < 0 {
+			addMsg("DBConfig.%s must not be negative:%d", field.name, field.val)
+		}
+	}
+	if dbConfig.MaxOpen > 0 && dbConfig.MaxIdle > dbConfig.MaxOpen {
+		addMsg("DBConfig.MaxIdle(%d) greater than DBConfig.MaxOpen(%d)", dbConfig.MaxIdle, dbConfig.MaxOpen)
+	}
+	validateDSNs := func(field string, dsns []string) {
+		for i, dsn := range dsns {
+			if dsn == "" {
+				addMsg("DBConfig.%s[%d] empty", field, i)
+				continue
+			}
+			if DriverName == "mysql" {
+				if _, err := mysql.ParseDSN(dsn); err != nil {
+					addMsg("DBConfig.%s[%d] invalid:%s", field, i, err.Error())
+				}
+			}
+		}
+	}
+	validateDSNs("Endpoints", dbConfig.Endpoints)
+	validateDSNs("Replicas", dbConfig.Replicas)
+	if !ReplicaPolicy(dbConfig.ReplicaPolicy).IsValid() {
+		addMsg("DBConfig.ReplicaPolicy invalid:%s", dbConfig.ReplicaPolicy)
+	}
+	if !LogLevel(dbConfig.LogLevel).IsValid() {
+		addMsg("DBConfig.LogLevel invalid:%s", dbConfig.LogLevel)
+	}
+	if len(msgs) > 0 {
+		err = errors.Errorf("invalid DBConfig: %s", strings.Join(msgs, "; "))
+		return err
+	}
+	return nil
+}
+
+// GetDSN DSN 不为空时直接返回,否则由结构化字段通过 mysql.Config 生成
+func (dbConfig DBConfig) GetDSN() (dsn string, err error) {
+	if dbConfig.DSN != "" {
+		return dbConfig.DSN, nil
+	}
+	cfg, err := dbConfig.MysqlConfig()
+	if err != nil {
+		return "", err
+	}
+	return cfg.FormatDSN(), nil
+}
+
+// MysqlConfig 由结构化字段生成 go-sql-driver 配置
+func (dbConfig DBConfig) MysqlConfig() (cfg *mysql.Config, err error) {
+	if dbConfig.Host == "" {
+		return nil, errors.New("DBConfig.Host required")
+	}
+	cfg = mysql.NewConfig()
+	cfg.Net = dbConfig.Net
+	if cfg.Net == "" {
+		cfg.Net = "tcp"
+	}
+	port := dbConfig.Port
+	if port == 0 {
+		port = 3306
+	}
+	cfg.Addr = net.JoinHostPort(dbConfig.Host, strconv.Itoa(port))
+	cfg.User = dbConfig.User
+	cfg.Passwd = dbConfig.Password
+	if dbConfig.PasswordFile != "" {
+		b, err := os.ReadFile(dbConfig.PasswordFile)
+		if err != nil {
+			return nil, errors.WithMessage(err, "DBConfig.PasswordFile")
+		}
+		cfg.Passwd = strings.TrimSpace(string(b))
+	}
+	cfg.DBName = dbConfig.Database
+	cfg.Collation = dbConfig.Collation
+	if dbConfig.Loc != "" {
+		cfg.Loc, err = time.LoadLocation(dbConfig.Loc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cfg.ParseTime = dbConfig.ParseTime
+	cfg.MultiStatements = dbConfig.MultiStatements
+	cfg.Timeout = time.Duration(dbConfig.ConnectTimeout) * time.Second
+	cfg.ReadTimeout = time.Duration(dbConfig.ReadTimeout) * time.Second
+	cfg.WriteTimeout = time.Duration(dbConfig.WriteTimeout) * time.Second
+	cfg.TLSConfig = dbConfig.TLS
+	cfg.Params = make(map[string]string, len(dbConfig.Params)+1)
+	for k, v := range dbConfig.Params {
+		cfg.Params[k] = v
+	}
+	charset := dbConfig.Charset
+	if charset == "" && dbConfig.Collation == "" {
+		charset = "utf8mb4"
+	}
+	if charset != "" {
+		cfg.Params["charset"] = charset
+	}
+	return cfg, nil
+}
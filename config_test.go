@@ -0,0 +1,112 @@
+package sqlexec_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestDBConfigGetDSN(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("p@ss:word\n"), 0o600))
+	cfg := sqlexec.DBConfig{
+		Host:            "127.0.0.1",
+		User:            "root",
+		PasswordFile:    passwordFile,
+		Database:        "curdservice",
+		Loc:             "Local",
+		MultiStatements: true,
+		ConnectTimeout:  5,
+		ReadTimeout:     6,
+		TLS:             "preferred",
+		Params:          map[string]string{"time_zone": "'+08:00'"},
+	}
+	require.NoError(t, cfg.Validate())
+	dsn, err := cfg.GetDSN()
+	require.NoError(t, err)
+	parsed, err := mysql.ParseDSN(dsn)
+	require.NoError(t, err)
+	assert.Equal(t, "tcp", parsed.Net)
+	assert.Equal(t, "127.0.0.1:3306", parsed.Addr)
+	assert.Equal(t, "p@ss:word", parsed.Passwd)
+	assert.Equal(t, "curdservice", parsed.DBName)
+	assert.Equal(t, "Local", parsed.Loc.String())
+	assert.True(t, parsed.MultiStatements)
+	assert.Equal(t, "preferred", parsed.TLSConfig)
+	assert.Equal(t, "utf8mb4", parsed.Params["charset"])
+	assert.Equal(t, "'+08:00'", parsed.Params["time_zone"])
+
+	raw := sqlexec.DBConfig{DSN: "root:123@tcp(127.0.0.1:3306)/db"}
+	dsn, err = raw.GetDSN()
+	require.NoError(t, err)
+	assert.Equal(t, raw.DSN, dsn)
+}
+
+func TestDBConfigValidate(t *testing.T) {
+	err := sqlexec.DBConfig{}.Validate()
+	require.ErrorContains(t, err, "DBConfig.DSN or DBConfig.Host or DBConfig.Endpoints required")
+	err = sqlexec.DBConfig{
+		Host:         "127.0.0.1",
+		Port:         70000,
+		Password:     "a",
+		PasswordFile: "b",
+		Loc:          "Mars/Base",
+		MaxOpen:      2,
+		MaxIdle:      3,
+		Timeout:      -1,
+	}.Validate()
+	require.Error(t, err)
+	for _, msg := range []string{"Port", "PasswordFile", "Loc", "MaxIdle", "Timeout"} {
+		assert.Contains(t, err.Error(), "DBConfig."+msg)
+	}
+}
+
+func TestDBConfigLoaders(t *testing.T) {
+	yamlConfig := `
+host: db.local
+port: 3307
+user: app
+database: curdservice
+timeout: 3
+params:
+  sql_mode: STRICT_ALL_TABLES
+`
+	cfg, err := sqlexec.YamlToDBConfig(yamlConfig)
+	require.NoError(t, err)
+	assert.Equal(t, "db.local", cfg.Host)
+	assert.Equal(t, 3307, cfg.Port)
+	assert.Equal(t, 3, cfg.Timeout)
+	assert.Equal(t, "STRICT_ALL_TABLES", cfg.Params["sql_mode"])
+
+	cfg, err = sqlexec.JsonToDBConfig(`{"host":"db.local","user":"app","maxOpen":10}`)
+	require.NoError(t, err)
+	assert.Equal(t, 10, cfg.MaxOpen)
+
+	t.Setenv("SQLEXEC_ORDER_DB_HOST", "db.local")
+	t.Setenv("SQLEXEC_ORDER_DB_PORT", "3308")
+	t.Setenv("SQLEXEC_ORDER_DB_MULTI_STATEMENTS", "true")
+	t.Setenv("SQLEXEC_ORDER_DB_MAX_IDLE_TIME", "5")
+	t.Setenv("SQLEXEC_ORDER_DB_PARAMS", "sql_mode=ANSI&autocommit=1")
+	t.Setenv("SQLEXEC_ORDER_DB_REPLICAS", "root:123@tcp(10.0.0.2:3306)/order, root:123@tcp(10.0.0.3:3306)/order")
+	t.Setenv("SQLEXEC_ORDER_DB_ENDPOINTS", "root:123@tcp(10.0.0.4:3306)/order,")
+	cfg, err = sqlexec.EnvToDBConfig("order-db")
+	require.NoError(t, err)
+	assert.Equal(t, "db.local", cfg.Host)
+	assert.Equal(t, 3308, cfg.Port)
+	assert.True(t, cfg.MultiStatements)
+	assert.Equal(t, 5, cfg.MaxIdleTime)
+	assert.Equal(t, map[string]string{"sql_mode": "ANSI", "autocommit": "1"}, cfg.Params)
+	assert.Equal(t, []string{"root:123@tcp(10.0.0.2:3306)/order", "root:123@tcp(10.0.0.3:3306)/order"}, cfg.Replicas)
+	assert.Equal(t, []string{"root:123@tcp(10.0.0.4:3306)/order"}, cfg.Endpoints)
+
+	_, err = sqlexec.EnvToDBConfig("missing")
+	require.ErrorIs(t, err, sqlexec.ERROR_EMPTY_CONFIG)
+	t.Setenv("SQLEXEC_BAD_PORT", "abc")
+	_, err = sqlexec.EnvToDBConfig("bad")
+	require.ErrorContains(t, err, "SQLEXEC_BAD_PORT")
+}
@@ -2,32 +2,26 @@ package sqlexec
 
 import (
 	"database/sql"
-	"sync"
 
 	"github.com/pkg/errors"
 )
 
 type GetDBI interface {
-	GetDB() *sql.DB
+	GetDB() (db *sql.DB, err error)
 }
 
-var dbMap sync.Map
-
+// RegisterDB 将已创建的连接池注册到 DefaultRegistry,连接池由调用方关闭
 func RegisterDB(identity string, db *sql.DB) (err error) {
-	dbMap.Store(identity, db)
+	DefaultRegistry.RegisterExecutor(identity, NewExecutorSQLWithDB(db))
 	return nil
 }
 
+// GetDB 从 DefaultRegistry 获取连接池
 func GetDB(identify string) (db *sql.DB, err error) {
-	val, ok := dbMap.Load(identify)
-	if !ok {
-		err = errors.Errorf("not found db by identify:%s,use RegisterDB to set", identify)
-		return nil, err
-	}
-	p, ok := val.(*sql.DB)
-	if !ok {
-		err = errors.Errorf("required:%v,got:%v", &sql.DB{}, val)
+	db, err = DefaultRegistry.GetDB(identify)
+	if err != nil {
+		err = errors.WithMessage(err, "use RegisterDB to set")
 		return nil, err
 	}
-	return p, nil
+	return db, nil
 }
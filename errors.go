@@ -0,0 +1,179 @@
+package sqlexec
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/sqlexec/sqlexecparser"
+)
+
+// 语句执行错误分类,ExecContext、QueryContext 等返回的错误可通过 errors.Is 判断;
+// 原错误(*mysql.MySQLError、网络错误、context 错误)仍可通过 errors.As、errors.Is 获取
+var (
+	ErrDuplicateKey    = errors.New("duplicate key")     // 1062、1586,详细信息见 *DuplicateKeyError
+	ErrDeadlock        = errors.New("deadlock")          // 1213
+	ErrLockWaitTimeout = errors.New("lock wait timeout") // 1205
+	ErrForeignKey      = errors.New("foreign key constraint fails")
+	ErrDataTooLong     = errors.New("data too long") // 1406,详细信息见 *DataTooLongError
+	ErrConnection      = errors.New("connection error")
+	ErrReadOnly        = errors.New("read only")
+	ErrQueryTimeout    = errors.New("query timeout")
+)
+
+// mysqlErrorKinds mysql 错误号对应的分类,1062、1586、1406 单独处理
+var mysqlErrorKinds = map[uint16]error{
+	1213: ErrDeadlock,
+	1205: ErrLockWaitTimeout,
+	1216: ErrForeignKey, // 子表插入、更新时父表记录不存在(旧版本)
+	1217: ErrForeignKey, // 删除、更新父表记录时存在子表记录(旧版本)
+	1451: ErrForeignKey,
+	1452: ErrForeignKey,
+	1040: ErrConnection,   // too many connections
+	1053: ErrConnection,   // server shutdown in progress
+	1152: ErrConnection,   // aborted connection
+	1158: ErrConnection,   // net read error
+	1159: ErrConnection,   // net read timeout
+	1160: ErrConnection,   // net write error
+	1161: ErrConnection,   // net write timeout
+	1290: ErrReadOnly,     // --read-only
+	1792: ErrReadOnly,     // read only transaction
+	1836: ErrReadOnly,     // read-only mode
+	3024: ErrQueryTimeout, // max_execution_time exceeded
+	1317: ErrQueryTimeout, // query execution was interrupted
+}
+
+// classifiedError 分类后的错误,Error() 与原错误相同
+type classifiedError struct {
+	kind error
+	err  error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// DuplicateKeyError 唯一键冲突,Error() 与原错误相同
+type DuplicateKeyError struct {
+	Table   string   // mysql 8.0.19 以上错误信息包含表名,否则为语句的第一个表
+	Key     string   // 索引名,主键为 PRIMARY
+	Value   string   // 冲突的值,联合索引的各列值以 - 连接
+	Columns []string // 索引的列,需通过 sqlexecparser.RegisterTable 注册表结构,否则为空
+	Err     *mysql.MySQLError
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DuplicateKeyError) Is(target error) bool {
+	return target == ErrDuplicateKey
+}
+
+func (e *DuplicateKeyError) Unwrap() error {
+	return e.Err
+}
+
+// DataTooLongError 数据超过列长度,Error() 与原错误相同
+type DataTooLongError struct {
+	Column string
+	Err    *mysql.MySQLError
+}
+
+func (e *DataTooLongError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DataTooLongError) Is(target error) bool {
+	return target == ErrDataTooLong
+}
+
+func (e *DataTooLongError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	duplicateKeyRegexp = regexp.MustCompile(`(?s)^Duplicate entry '(.*)' for key '([^']*)'$`)
+	dataTooLongRegexp  = regexp.MustCompile(`^Data too long for column '([^']*)'`)
+)
+
+// ClassifyError 按错误分类包装err,无法分类或已分类时返回原错误;dbName、sqls 用于查找唯一键对应的列,可以为空
+func ClassifyError(err error, dbName string, sqls string) error {
+	if err == nil {
+		return nil
+	}
+	var classified *classifiedError
+	var duplicate *DuplicateKeyError
+	var tooLong *DataTooLongError
+	if errors.As(err, &classified) || errors.As(err, &duplicate) || errors.As(err, &tooLong) {
+		return err
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1062, 1586:
+			return newDuplicateKeyError(mysqlErr, dbName, sqls)
+		case 1406:
+			tooLong := &DataTooLongError{Err: mysqlErr}
+			if match := dataTooLongRegexp.FindStringSubmatch(mysqlErr.Message); match != nil {
+				tooLong.Column = match[1]
+			}
+			return tooLong
+		}
+		if kind, ok := mysqlErrorKinds[mysqlErr.Number]; ok {
+			return &classifiedError{kind: kind, err: err}
+		}
+		return err
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &classifiedError{kind: ErrQueryTimeout, err: err}
+	case IsNetworkError(err):
+		return &classifiedError{kind: ErrConnection, err: err}
+	}
+	return err
+}
+
+func newDuplicateKeyError(mysqlErr *mysql.MySQLError, dbName string, sqls string) (duplicate *DuplicateKeyError) {
+	duplicate = &DuplicateKeyError{Err: mysqlErr}
+	match := duplicateKeyRegexp.FindStringSubmatch(mysqlErr.Message)
+	if match == nil {
+		return duplicate
+	}
+	duplicate.Value, duplicate.Key = match[1], match[2]
+	if i := strings.LastIndexByte(duplicate.Key, '.'); i >= 0 { // mysql 8.0.19 以上为 表名.索引名
+		duplicate.Table, duplicate.Key = duplicate.Key[:i], duplicate.Key[i+1:]
+	}
+	if duplicate.Table == "" {
+		if stmt, err := ParseStatement(sqls); err == nil {
+			if tables := stmt.Tables(); len(tables) > 0 {
+				duplicate.Table = tables[0]
+			}
+		}
+	}
+	table := duplicate.Table
+	if i := strings.LastIndexByte(table, '.'); i >= 0 {
+		dbName, table = table[:i], table[i+1:]
+	}
+	if table == "" || dbName == "" {
+		return duplicate
+	}
+	tableDef, err := sqlexecparser.GetTable(sqlexecparser.DBName(dbName), sqlexecparser.TableName(table))
+	if err != nil {
+		return duplicate
+	}
+	if columnNames, ok := tableDef.GetKeyColumnNames(duplicate.Key); ok {
+		duplicate.Columns = columnNames.ToString()
+	}
+	return duplicate
+}
@@ -0,0 +1,91 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+	"github.com/suifengpiao14/sqlexec/sqlexecparser"
+)
+
+func TestClassifyError(t *testing.T) {
+	require.NoError(t, sqlexecparser.RegisterTableByDDL("CREATE TABLE errdb.member (id int NOT NULL AUTO_INCREMENT, name varchar(8) NOT NULL, tenant_id int NOT NULL, PRIMARY KEY (id), UNIQUE KEY uk_tenant_name (tenant_id,name)) ENGINE=InnoDB;"))
+	ctx := context.Background()
+	errs := map[string]error{
+		"8.0 duplicate": &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1-it's' for key 'member.uk_tenant_name'"},
+		"5.7 duplicate": &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '7' for key 'PRIMARY'"},
+		"too long":      &mysql.MySQLError{Number: 1406, Message: "Data too long for column 'name' at row 1"},
+		"deadlock":      &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock; try restarting transaction"},
+		"lock wait":     &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded; try restarting transaction"},
+		"foreign key":   &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails"},
+		"read only":     &mysql.MySQLError{Number: 1290, Message: "The MySQL server is running with the --read-only option"},
+		"timeout":       &mysql.MySQLError{Number: 3024, Message: "Query execution was interrupted, maximum statement execution time exceeded"},
+		"other":         &mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"},
+	}
+	server := newFakeServer(t, "root:123@tcp(127.0.0.1:3306)/errdb", func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		for name, err := range errs {
+			if strings.Contains(query, "/*"+name+"*/") {
+				return nil, err
+			}
+		}
+		return &fakeResponse{rowsAffected: 1}, nil
+	})
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: "root:123@tcp(127.0.0.1:3306)/errdb"}, nil)
+	executor.SetBackoffPolicy(sqlexec.BackoffPolicy{MaxAttempts: 1})
+	t.Cleanup(func() { executor.Close() })
+	exec := func(name string) error {
+		var rowsAffected int
+		return executor.ExecOrQueryContext(ctx, "update member set name='a' where id=1 /*"+name+"*/", &rowsAffected)
+	}
+
+	err := exec("8.0 duplicate")
+	require.ErrorIs(t, err, sqlexec.ErrDuplicateKey)
+	assert.Equal(t, errs["8.0 duplicate"].Error(), err.Error())
+	var duplicate *sqlexec.DuplicateKeyError
+	require.ErrorAs(t, err, &duplicate)
+	assert.Equal(t, "member", duplicate.Table)
+	assert.Equal(t, "uk_tenant_name", duplicate.Key)
+	assert.Equal(t, "1-it's", duplicate.Value)
+	assert.Equal(t, []string{"tenant_id", "name"}, duplicate.Columns)
+	var mysqlErr *mysql.MySQLError
+	require.ErrorAs(t, err, &mysqlErr)
+	assert.Equal(t, uint16(1062), mysqlErr.Number)
+
+	err = exec("5.7 duplicate") // 错误信息不含表名时使用语句的表
+	require.ErrorAs(t, err, &duplicate)
+	assert.Equal(t, "member", duplicate.Table)
+	assert.Equal(t, []string{"id"}, duplicate.Columns)
+
+	err = exec("too long")
+	var tooLong *sqlexec.DataTooLongError
+	require.ErrorAs(t, err, &tooLong)
+	assert.Equal(t, "name", tooLong.Column)
+	assert.ErrorIs(t, err, sqlexec.ErrDataTooLong)
+
+	for name, kind := range map[string]error{
+		"deadlock":    sqlexec.ErrDeadlock,
+		"lock wait":   sqlexec.ErrLockWaitTimeout,
+		"foreign key": sqlexec.ErrForeignKey,
+		"read only":   sqlexec.ErrReadOnly,
+		"timeout":     sqlexec.ErrQueryTimeout,
+	} {
+		err := exec(name)
+		assert.ErrorIs(t, err, kind, name)
+		assert.ErrorAs(t, err, &mysqlErr, name)
+	}
+	err = exec("other")
+	assert.Same(t, errs["other"], errors.Cause(err))
+	assert.NotErrorIs(t, err, sqlexec.ErrConnection)
+
+	server.SetDown(true)
+	defer server.SetDown(false)
+	_, err = sqlexec.QueryContext(ctx, mustGetDB(t, executor), "select id from member")
+	assert.ErrorIs(t, err, sqlexec.ErrConnection)
+	assert.True(t, sqlexec.IsNetworkError(err))
+}
@@ -0,0 +1,269 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/logchan/v2"
+	"github.com/suifengpiao14/sshmysql"
+)
+
+var (
+	ERROR_NO_AVAILABLE_ENDPOINT = errors.New("no available endpoint")
+	ERROR_ENDPOINT_READ_ONLY    = errors.New("endpoint is read only")
+)
+
+const (
+	LOG_INFO_FAILOVER LogName = "LogInfoFailover"
+)
+
+// DefaultFailoverTimeout 切换主库时探测所有候选地址的超时时间
+var DefaultFailoverTimeout = 10 * time.Second
+
+// LogInfoFailover 主库切换日志
+type LogInfoFailover struct {
+	From    string    `json:"from"` // 切换前的地址,首次连接时为空
+	To      string    `json:"to"`   // 切换后的地址,切换失败时为空
+	Reason  string    `json:"reason"`
+	Err     error     `json:"error"`
+	BeginAt time.Time `json:"beginAt"`
+	EndAt   time.Time `json:"endAt"`
+	logchan.EmptyLogInfo
+}
+
+func (l *LogInfoFailover) GetName() logchan.LogName {
+	return LOG_INFO_FAILOVER
+}
+func (l *LogInfoFailover) Error() error {
+	return l.Err
+}
+
+// endpoint 主库候选地址
+type endpoint struct {
+	index int
+	dsn   string
+}
+
+// String 不含密码的地址,用于日志
+func (ep endpoint) String() string {
+	cfg, err := mysql.ParseDSN(ep.dsn)
+	if err != nil || cfg.Addr == "" {
+		return fmt.Sprintf("endpoint-%d", ep.index)
+	}
+	return fmt.Sprintf("endpoint-%d(%s/%s)", ep.index, cfg.Addr, cfg.DBName)
+}
+
+// endpoints 按优先级排列的主库候选地址: DSN(或 Host 生成的DSN)在前, Endpoints 在后
+func (dbConfig DBConfig) endpoints() (endpoints []endpoint, err error) {
+	endpoints = make([]endpoint, 0, len(dbConfig.Endpoints)+1)
+	if dbConfig.DSN != "" || dbConfig.Host != "" {
+		dsn, err := dbConfig.GetDSN()
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint{dsn: dsn})
+	}
+	for _, dsn := range dbConfig.Endpoints {
+		endpoints = append(endpoints, endpoint{index: len(endpoints), dsn: dsn})
+	}
+	if len(endpoints) == 0 {
+		return nil, ERROR_NO_AVAILABLE_ENDPOINT
+	}
+	return endpoints, nil
+}
+
+// IsFailoverError 是否需要切换主库:连接级别的错误,或者主库已变为只读(1290 --read-only、1836 read-only 模式)
+func IsFailoverError(err error) bool {
+	if IsNetworkError(err) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1290 || mysqlErr.Number == 1836
+	}
+	return false
+}
+
+const (
+	context_Key_ConnFailure contextKey = "sqlexec_conn_failure"
+)
+
+// connFailure ctx 内 driver 调用返回的需要切换主库的错误,只记录第一个;闭包、中间件等返回的其它错误不会触发切换
+type connFailure struct {
+	mu  sync.Mutex
+	db  *sql.DB
+	err error
+}
+
+// withConnFailure 记录之后在ctx 内 driver 调用出现的连接级别错误
+func withConnFailure(ctx context.Context) (context.Context, *connFailure) {
+	failure := &connFailure{}
+	return context.WithValue(ctx, context_Key_ConnFailure, failure), failure
+}
+
+// recordConnFailure 在 driver 调用返回错误处调用,ctx 取消、超时导致的错误不会记录
+func recordConnFailure(ctx context.Context, db *sql.DB, err error) {
+	if ctx.Err() != nil || !IsFailoverError(err) {
+		return
+	}
+	failure, ok := ctx.Value(context_Key_ConnFailure).(*connFailure)
+	if !ok {
+		return
+	}
+	failure.mu.Lock()
+	defer failure.mu.Unlock()
+	if failure.err == nil {
+		failure.db, failure.err = db, err
+	}
+}
+
+// get db 上记录的错误,没有时返回nil
+func (f *connFailure) get(db *sql.DB) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.db != db {
+		return nil
+	}
+	return f.err
+}
+
+// callDB 在db 上执行fn,fn 返回错误时同时返回其中 driver 调用出现的需要切换主库的错误
+func callDB(ctx context.Context, db *sql.DB, fn func(ctx context.Context, db *sql.DB) error) (connErr error, err error) {
+	ctx, failure := withConnFailure(ctx)
+	err = fn(ctx, db)
+	if err == nil {
+		return nil, nil
+	}
+	return failure.get(db), err
+}
+
+// connectEndpoint 从第 from 个候选地址开始按顺序探测(之前的地址排在最后),返回第一个可以连接(开启 CheckReadOnly 时需要 @@read_only=0)的连接池
+func connectEndpoint(ctx context.Context, dbConfig DBConfig, sshConfig *sshmysql.SSHConfig, from int) (db *sql.DB, tunnel io.Closer, ep endpoint, err error) {
+	endpoints, err := dbConfig.endpoints()
+	if err != nil {
+		return nil, nil, ep, err
+	}
+	from %= len(endpoints)
+	endpoints = append(append(make([]endpoint, 0, len(endpoints)), endpoints[from:]...), endpoints[:from]...)
+	for _, ep = range endpoints {
+		db, tunnel, err = probeEndpoint(ctx, ep, dbConfig.CheckReadOnly, sshConfig)
+		if err == nil {
+			return db, tunnel, ep, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(endpoints) > 1 {
+		err = fmt.Errorf("%w(tried %d endpoints): %w", ERROR_NO_AVAILABLE_ENDPOINT, len(endpoints), err) // 保留最后一个错误,以便判断是否可重试
+	}
+	return nil, nil, ep, err
+}
+
+func probeEndpoint(ctx context.Context, ep endpoint, checkReadOnly bool, sshConfig *sshmysql.SSHConfig) (db *sql.DB, tunnel io.Closer, err error) {
+	db, tunnel, err = connectDB(DBConfig{DSN: ep.dsn}, sshConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = checkEndpoint(ctx, db, checkReadOnly)
+	if err != nil {
+		closeDB(db, tunnel)
+		err = errors.WithMessage(err, ep.String())
+		return nil, nil, err
+	}
+	return db, tunnel, nil
+}
+
+// checkEndpoint ping 数据库,checkReadOnly 为true 时要求 @@read_only=0
+func checkEndpoint(ctx context.Context, db *sql.DB, checkReadOnly bool) (err error) {
+	err = db.PingContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !checkReadOnly {
+		return nil
+	}
+	var readOnly int
+	err = db.QueryRowContext(ctx, "SELECT @@read_only").Scan(&readOnly)
+	if err != nil {
+		return err
+	}
+	if readOnly != 0 {
+		return ERROR_ENDPOINT_READ_ONLY
+	}
+	return nil
+}
+
+// failover failed 连接池出现连接级别错误后从下一个候选地址开始重新探测并替换连接池,旧连接池在后台关闭;
+// 探测期间不持有 e.mu,其它调用正在切换或已经完成切换时直接返回
+func (e *ExecutorSQL) failover(ctx context.Context, failed *sql.DB, reason error) (err error) {
+	e.mu.Lock()
+	if e.closed || e._db != failed || e.failingOver {
+		e.mu.Unlock()
+		return nil
+	}
+	e.failingOver = true
+	dbConfig, sshConfig, from := e.dbConfig, e.sshConfig, e.endpoint.index+1
+	logInfo := &LogInfoFailover{From: e.endpoint.String(), BeginAt: time.Now().Local()}
+	e.mu.Unlock()
+	if reason != nil {
+		logInfo.Reason = reason.Error()
+	}
+	defer func() {
+		logInfo.EndAt = time.Now().Local()
+		logInfo.Err = err
+		logchan.SendLogInfo(logInfo)
+	}()
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), DefaultFailoverTimeout) // 不受触发切换的调用方取消影响
+	defer cancel()
+	db, tunnel, ep, err := connectEndpoint(ctx, dbConfig, sshConfig, from)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failingOver = false
+	if err != nil {
+		return err
+	}
+	if e.closed || e._db != failed { // 探测期间已关闭或连接池已被替换
+		go closeDB(db, tunnel)
+		return nil
+	}
+	logInfo.To = ep.String()
+	oldDB, oldTunnel := e._db, e.tunnel
+	e.setPrimary(db, tunnel, ep)
+	go closeDB(oldDB, oldTunnel) // sql.DB.Close 会等待已开始的查询结束
+	return nil
+}
+
+// setPrimary 设置主库连接池,调用方需持有 e.mu
+func (e *ExecutorSQL) setPrimary(db *sql.DB, tunnel io.Closer, ep endpoint) {
+	cfg := e.dbConfig
+	db.SetMaxOpenConns(cfg.MaxOpen)
+	db.SetMaxIdleConns(cfg.MaxIdle)
+	db.SetConnMaxIdleTime(time.Duration(cfg.MaxIdleTime) * time.Minute)
+	e._db, e.tunnel, e.endpoint = db, tunnel, ep
+}
+
+// Endpoint 当前使用的主库地址(不含密码),未连接时为空
+func (e *ExecutorSQL) Endpoint() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e._db == nil {
+		return ""
+	}
+	return e.endpoint.String()
+}
+
+// Failover 主动探测候选地址并切换主库,通常在收到外部的主从切换通知时调用
+func (e *ExecutorSQL) Failover(ctx context.Context) (err error) {
+	db, err := e.getDB(ctx)
+	if err != nil {
+		return err
+	}
+	return e.failover(ctx, db, errors.New("manual failover"))
+}
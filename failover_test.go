@@ -0,0 +1,169 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+// openEndpointServer 模拟可切换只读状态的主库,查询返回服务名
+func openEndpointServer(t *testing.T, dsn string, name string, readOnly *atomic.Bool) (server *fakeServer) {
+	return newFakeServer(t, dsn, func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		if strings.Contains(query, "@@read_only") {
+			n := int64(0)
+			if readOnly.Load() {
+				n = 1
+			}
+			return &fakeResponse{columns: []string{"@@read_only"}, rows: [][]driver.Value{{n}}}, nil
+		}
+		if hasPrefixFold(query, "update") && readOnly.Load() {
+			return nil, &mysql.MySQLError{Number: 1290, Message: "The MySQL server is running with the --read-only option"}
+		}
+		return &fakeResponse{columns: []string{"server", "id"}, rows: [][]driver.Value{{[]byte(name), int64(1)}}, rowsAffected: 1}, nil
+	})
+}
+
+func TestExecutorSQLFailover(t *testing.T) {
+	ctx := context.Background()
+	name := t.Name()
+	var readOnly0, readOnly1 atomic.Bool
+	server0 := openEndpointServer(t, name+"0", "server0", &readOnly0)
+	server1 := openEndpointServer(t, name+"1", "server1", &readOnly1)
+	newExecutor := func() *sqlexec.ExecutorSQL {
+		executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{Endpoints: []string{name + "0", name + "1"}, CheckReadOnly: true}, nil)
+		executor.SetBackoffPolicy(sqlexec.BackoffPolicy{MaxAttempts: 1})
+		executor.SetSingleflight(false)
+		t.Cleanup(func() { executor.Close() })
+		return executor
+	}
+	query := func(executor *sqlexec.ExecutorSQL) (server string, err error) {
+		var out []map[string]string
+		err = executor.ExecOrQueryContext(ctx, "select server,id from service", &out)
+		if err != nil {
+			return "", err
+		}
+		return out[0]["server"], nil
+	}
+
+	t.Run("skip read only", func(t *testing.T) {
+		readOnly0.Store(true)
+		defer readOnly0.Store(false)
+		executor := newExecutor()
+		require.NoError(t, executor.Open(ctx))
+		assert.Equal(t, "endpoint-1", executor.Endpoint())
+	})
+	t.Run("connection failure", func(t *testing.T) {
+		executor := newExecutor()
+		server, err := query(executor)
+		require.NoError(t, err)
+		assert.Equal(t, "server0", server)
+
+		server0.SetDown(true)
+		defer server0.SetDown(false)
+		_, err = query(executor) // 出错的调用返回原错误,同时切换主库
+		require.Error(t, err)
+		assert.Equal(t, "endpoint-1", executor.Endpoint())
+		server, err = query(executor)
+		require.NoError(t, err)
+		assert.Equal(t, "server1", server)
+	})
+	t.Run("demoted to read only", func(t *testing.T) {
+		executor := newExecutor()
+		require.NoError(t, executor.Open(ctx))
+		assert.Equal(t, "endpoint-0", executor.Endpoint())
+		readOnly0.Store(true)
+		defer readOnly0.Store(false)
+		var rowsAffected int
+		err := executor.ExecOrQueryContext(ctx, "update service set name='a' where id=1", &rowsAffected)
+		require.True(t, sqlexec.IsFailoverError(err))
+		assert.Equal(t, "endpoint-1", executor.Endpoint())
+		require.NoError(t, executor.ExecOrQueryContext(ctx, "update service set name='a' where id=1", &rowsAffected))
+	})
+	t.Run("transaction keeps its pool", func(t *testing.T) {
+		executor := newExecutor()
+		err := executor.WithTransaction(ctx, func(txCtx context.Context) error {
+			readOnly0.Store(true)
+			defer readOnly0.Store(false)
+			require.NoError(t, executor.Failover(txCtx))
+			assert.Equal(t, "endpoint-1", executor.Endpoint())
+			var out []map[string]string
+			require.NoError(t, executor.ExecOrQueryContext(txCtx, "select server,id from service", &out))
+			assert.Equal(t, "server0", out[0]["server"], "事务内的语句不能切换到新主库")
+			return nil
+		})
+		require.NoError(t, err)
+		server, err := query(executor)
+		require.NoError(t, err)
+		assert.Equal(t, "server1", server)
+	})
+	t.Run("next endpoint", func(t *testing.T) { // 从出错地址的下一个开始探测
+		executor := newExecutor()
+		require.NoError(t, executor.Open(ctx))
+		require.NoError(t, executor.Failover(ctx))
+		assert.Equal(t, "endpoint-1", executor.Endpoint())
+		require.NoError(t, executor.Failover(ctx))
+		assert.Equal(t, "endpoint-0", executor.Endpoint())
+	})
+	t.Run("closure error", func(t *testing.T) { // 闭包自身返回的网络错误(如调用其它服务超时)不切换
+		executor := newExecutor()
+		db, err := executor.GetDB()
+		require.NoError(t, err)
+		err = executor.WithTransaction(ctx, func(txCtx context.Context) error {
+			_, err := query(executor)
+			require.NoError(t, err)
+			return &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("http api timeout")}
+		})
+		require.Error(t, err)
+		current, err := executor.GetDB()
+		require.NoError(t, err)
+		assert.Same(t, db, current)
+	})
+	t.Run("statement timeout", func(t *testing.T) {
+		slow := name + "slow"
+		newFakeServer(t, slow, func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+			time.Sleep(20 * time.Millisecond)
+			return nil, driver.ErrBadConn // 超时后连接被驱动关闭
+		})
+		executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{Endpoints: []string{slow, name + "1"}}, nil)
+		t.Cleanup(func() { executor.Close() })
+		db, err := executor.GetDB()
+		require.NoError(t, err)
+		var out []map[string]string
+		err = executor.ExecOrQueryContext(sqlexec.WithStatementTimeout(ctx, 5*time.Millisecond), "select server,id from service", &out)
+		require.Error(t, err)
+		current, err := executor.GetDB()
+		require.NoError(t, err)
+		assert.Same(t, db, current)
+	})
+	t.Run("no available endpoint", func(t *testing.T) {
+		executor := newExecutor()
+		require.NoError(t, executor.Open(ctx))
+		server0.SetDown(true)
+		server1.SetDown(true)
+		_, err := query(executor)
+		require.Error(t, err)
+		assert.Equal(t, "endpoint-0", executor.Endpoint()) // 切换失败时保留原连接池,下次出错时重新探测
+		require.ErrorIs(t, executor.Failover(ctx), sqlexec.ERROR_NO_AVAILABLE_ENDPOINT)
+
+		server1.SetDown(false)
+		require.NoError(t, executor.Failover(ctx))
+		assert.Equal(t, "endpoint-1", executor.Endpoint())
+		server0.SetDown(false)
+	})
+}
+
+func TestIsFailoverError(t *testing.T) {
+	assert.True(t, sqlexec.IsFailoverError(driver.ErrBadConn))
+	assert.True(t, sqlexec.IsFailoverError(errors.WithMessage(&mysql.MySQLError{Number: 1836}, "exec")))
+	assert.False(t, sqlexec.IsFailoverError(&mysql.MySQLError{Number: 1062}))
+}
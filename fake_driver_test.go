@@ -0,0 +1,237 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// fakeDriverName 测试用驱动，按dsn 查找 fakeServer，不依赖真实mysql
+const fakeDriverName = "sqlexecfake"
+
+func init() {
+	sql.Register(fakeDriverName, &fakeDriver{})
+}
+
+var fakeServers sync.Map
+
+// fakeResponse 一次语句执行的返回，next 用于模拟多结果集
+type fakeResponse struct {
+	columns      []string
+	types        []string
+	rows         [][]driver.Value
+	lastInsertId int64
+	rowsAffected int64
+	next         *fakeResponse
+}
+
+type fakeHandler func(query string, args []driver.NamedValue) (resp *fakeResponse, err error)
+
+type fakeServer struct {
+	mu      sync.Mutex
+	dsn     string
+	handler fakeHandler
+	log     []string
+	down    bool
+	dials   int64
+}
+
+// newFakeServer 注册一个以dsn 为标识的模拟数据库
+func newFakeServer(t *testing.T, dsn string, handler fakeHandler) (server *fakeServer) {
+	server = &fakeServer{dsn: dsn, handler: handler}
+	fakeServers.Store(dsn, server)
+	t.Cleanup(func() {
+		fakeServers.Delete(dsn)
+	})
+	return server
+}
+
+// openFakeDB 注册模拟数据库并返回连接
+func openFakeDB(t *testing.T, dsn string, handler fakeHandler) (db *sql.DB, server *fakeServer) {
+	server = newFakeServer(t, dsn, handler)
+	db, err := sql.Open(fakeDriverName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db, server
+}
+
+func (s *fakeServer) record(query string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = append(s.log, query)
+}
+
+// Log 返回服务端收到的语句(含 BEGIN/COMMIT/ROLLBACK)
+func (s *fakeServer) Log() (log []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log = make([]string, len(s.log))
+	copy(log, s.log)
+	return log
+}
+
+// Dials 建立连接的次数
+func (s *fakeServer) Dials() int64 {
+	return atomic.LoadInt64(&s.dials)
+}
+
+func (s *fakeServer) SetDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (s *fakeServer) isDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.down
+}
+
+func (s *fakeServer) handle(query string, args []driver.NamedValue) (resp *fakeResponse, err error) {
+	if s.isDown() {
+		return nil, driver.ErrBadConn
+	}
+	s.record(query)
+	if s.handler == nil {
+		return &fakeResponse{}, nil
+	}
+	resp, err = s.handler(query, args)
+	if resp == nil && err == nil {
+		resp = &fakeResponse{}
+	}
+	return resp, err
+}
+
+type fakeDriver struct{}
+
+func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
+	v, ok := fakeServers.Load(dsn)
+	if !ok {
+		return nil, errors.Errorf("fake server not found: %s", dsn)
+	}
+	server := v.(*fakeServer)
+	atomic.AddInt64(&server.dials, 1)
+	if server.isDown() { // 模拟连接被拒绝
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.Errorf("fake server down: %s", dsn)}
+	}
+	return &fakeConn{server: server}, nil
+}
+
+type fakeConn struct {
+	server *fakeServer
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fake driver: prepare not supported")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if _, err := c.server.handle("BEGIN", nil); err != nil {
+		return nil, err
+	}
+	return &fakeTx{conn: c}, nil
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	if c.server.isDown() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	resp, err := c.server.handle(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return fakeResult{lastInsertId: resp.lastInsertId, rowsAffected: resp.rowsAffected}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	resp, err := c.server.handle(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{resp: resp}, nil
+}
+
+type fakeTx struct {
+	conn *fakeConn
+}
+
+func (tx *fakeTx) Commit() error {
+	_, err := tx.conn.server.handle("COMMIT", nil)
+	return err
+}
+
+func (tx *fakeTx) Rollback() error {
+	_, err := tx.conn.server.handle("ROLLBACK", nil)
+	return err
+}
+
+type fakeResult struct {
+	lastInsertId int64
+	rowsAffected int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.lastInsertId, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+type fakeRows struct {
+	resp *fakeResponse
+	pos  int
+}
+
+func (r *fakeRows) Columns() []string { return r.resp.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.resp.rows) {
+		return io.EOF
+	}
+	copy(dest, r.resp.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+func (r *fakeRows) HasNextResultSet() bool { return r.resp.next != nil }
+
+func (r *fakeRows) NextResultSet() error {
+	if r.resp.next == nil {
+		return io.EOF
+	}
+	r.resp = r.resp.next
+	r.pos = 0
+	return nil
+}
+
+func (r *fakeRows) ColumnTypeDatabaseTypeName(index int) string {
+	if index < len(r.resp.types) {
+		return r.resp.types[index]
+	}
+	return "VARCHAR"
+}
+
+// hasPrefixFold 判断语句前缀，忽略大小写
+func hasPrefixFold(query string, prefix string) bool {
+	query = strings.TrimSpace(query)
+	return len(query) >= len(prefix) && strings.EqualFold(query[:len(prefix)], prefix)
+}
@@ -0,0 +1,225 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoRows QueryOne 未查询到数据时返回,与 sql.ErrNoRows 相同,可用 errors.Is 判断
+var ErrNoRows = sql.ErrNoRows
+
+// Query 查询结果直接扫描到T,T 为结构体(或结构体指针)时按 db、json 标签(没有标签时使用字段名,不区分大小写)匹配列名,支持嵌入结构体、指针字段(NULL 为nil)、sql.Scanner 字段;T 为基础类型时读取第一列
+func Query[T any](ctx context.Context, executor GetDBI, sqls string, args ...any) (result []T, err error) {
+	err = withExecutorDB(ctx, executor, sqls, func(ctx context.Context, db *sql.DB) (err error) {
+		result = make([]T, 0) // 重试或改用主库时重新读取
+		_, err = queryRows(ctx, db, sqls, args, func(rows *sql.Rows) (rowsAffected int64, err error) {
+			columns, err := rows.Columns()
+			if err != nil {
+				return 0, err
+			}
+			for rows.Next() {
+				var record T
+				err = scanStruct(rows, columns, &record)
+				if err != nil {
+					return rowsAffected, err
+				}
+				rowsAffected++
+				result = append(result, record)
+			}
+			return rowsAffected, rows.Err()
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// QueryOne 查询第一行数据,没有数据时返回 ErrNoRows
+func QueryOne[T any](ctx context.Context, executor GetDBI, sqls string, args ...any) (record T, err error) {
+	found := false
+	err = withExecutorDB(ctx, executor, sqls, func(ctx context.Context, db *sql.DB) (err error) {
+		var zero T
+		record, found = zero, false
+		_, err = queryRows(ctx, db, sqls, args, func(rows *sql.Rows) (rowsAffected int64, err error) {
+			columns, err := rows.Columns()
+			if err != nil {
+				return 0, err
+			}
+			if !rows.Next() {
+				return 0, rows.Err()
+			}
+			err = scanStruct(rows, columns, &record)
+			if err != nil {
+				return 0, err
+			}
+			found = true
+			return 1, nil
+		})
+		return err
+	})
+	if err != nil {
+		return record, err
+	}
+	if !found {
+		return record, ErrNoRows
+	}
+	return record, nil
+}
+
+// Exec 执行写语句,返回最后插入的id和影响行数
+func Exec(ctx context.Context, executor GetDBI, sqls string, args ...any) (lastInsertId int64, rowsAffected int64, err error) {
+	err = withExecutorDB(ctx, executor, sqls, func(ctx context.Context, db *sql.DB) (err error) {
+		lastInsertId, rowsAffected, err = ExecContext(ctx, db, sqls, args...)
+		return err
+	})
+	return lastInsertId, rowsAffected, err
+}
+
+// withExecutorDB executor 为 ExecutorSQL 时写入其配置,与 ExecOrQueryContext 一样经过重试、读写分离、事务及主库切换;
+// 否则在 GetDB 返回的连接池上执行fn
+func withExecutorDB(ctx context.Context, executor GetDBI, sqls string, fn func(ctx context.Context, db *sql.DB) error) (err error) {
+	e, ok := executor.(*ExecutorSQL)
+	if !ok {
+		db, err := executor.GetDB()
+		if err != nil {
+			return err
+		}
+		return fn(ctx, db)
+	}
+	ctx = e.withExecutorContext(ctx)
+	ctx, _, _ = withParsedStatement(ctx, sqls)
+	return e.withRetry(ctx, isRetryableStatement(ctx, sqls), func(ctx context.Context) (err error) {
+		return e.withRoutedDB(ctx, sqls, true, fn)
+	})
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// scanStruct 扫描当前行到dst 指向的值
+func scanStruct(rows *sql.Rows, columns []string, dst any) (err error) {
+	rv := reflect.ValueOf(dst).Elem()
+	if rv.Kind() == reflect.Ptr && isStructTarget(rv.Type().Elem()) { // T 为结构体指针
+		rv.Set(reflect.New(rv.Type().Elem()))
+		rv = rv.Elem()
+	}
+	if !isStructTarget(rv.Type()) {
+		if len(columns) != 1 {
+			err = errors.Errorf("scan to %s expected 1 column,got:%d", rv.Type().String(), len(columns))
+			return err
+		}
+		return rows.Scan(dst)
+	}
+	fields := getStructFields(rv.Type())
+	dest := make([]any, len(columns))
+	for i, column := range columns {
+		index, ok := fields[strings.ToLower(column)]
+		if !ok {
+			dest[i] = new(any) // 结构体中不存在的列丢弃
+			continue
+		}
+		dest[i] = fieldByIndexAlloc(rv, index).Addr().Interface()
+	}
+	return rows.Scan(dest...)
+}
+
+// isStructTarget 判断是否需要按列名映射到结构体字段,实现了 sql.Scanner 的结构体和time.Time 直接扫描
+func isStructTarget(rt reflect.Type) bool {
+	if rt.Kind() != reflect.Struct || rt == timeType {
+		return false
+	}
+	return !reflect.PointerTo(rt).Implements(scannerType)
+}
+
+var structFieldsCache sync.Map
+
+// getStructFields 获取列名(小写)到字段索引的映射,嵌入结构体的字段展开到外层
+func getStructFields(rt reflect.Type) (fields map[string][]int) {
+	if v, ok := structFieldsCache.Load(rt); ok {
+		return v.(map[string][]int)
+	}
+	fields = make(map[string][]int)
+	collectStructFields(rt, nil, fields)
+	structFieldsCache.Store(rt, fields)
+	return fields
+}
+
+func collectStructFields(rt reflect.Type, parent []int, fields map[string][]int) {
+	type embedded struct {
+		rt    reflect.Type
+		index []int
+	}
+	embeddeds := make([]embedded, 0)
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		index := append(append([]int{}, parent...), i)
+		name, ok := fieldColumnName(field)
+		if !ok {
+			continue
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && isStructTarget(fieldType) {
+			embeddeds = append(embeddeds, embedded{rt: fieldType, index: index})
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		name = strings.ToLower(name)
+		if _, exists := fields[name]; exists { // 外层字段优先
+			continue
+		}
+		fields[name] = index
+	}
+	for _, e := range embeddeds { // 外层字段收集完后再展开嵌入结构体
+		collectStructFields(e.rt, e.index, fields)
+	}
+}
+
+// fieldColumnName 获取字段对应的列名,db 标签优先,其次json 标签;标签为"-"时忽略该字段
+func fieldColumnName(field reflect.StructField) (name string, ok bool) {
+	for _, tagName := range []string{"db", "json"} {
+		tag, exists := field.Tag.Lookup(tagName)
+		if !exists {
+			continue
+		}
+		name = strings.Split(tag, ",")[0]
+		if name == "-" {
+			return "", false
+		}
+		if name != "" {
+			return name, true
+		}
+	}
+	return "", true
+}
+
+// fieldByIndexAlloc 按索引获取字段,途经的nil 嵌入指针自动初始化
+func fieldByIndexAlloc(rv reflect.Value, index []int) reflect.Value {
+	for i, idx := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(idx)
+	}
+	return rv
+}
@@ -0,0 +1,80 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+type fakeGetDB struct {
+	db *sql.DB
+}
+
+func (f fakeGetDB) GetDB() (*sql.DB, error) {
+	return f.db, nil
+}
+
+type Timestamps struct {
+	CreatedAt string `db:"created_at"`
+}
+
+type Service struct {
+	ID       int64          `db:"id"`
+	Name     string         `json:"name"`
+	Remark   *string        `db:"remark"`
+	Nickname sql.NullString `db:"nickname"`
+	Ignore   string         `db:"-"`
+	Timestamps
+}
+
+func TestQueryGeneric(t *testing.T) {
+	db, _ := openFakeDB(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		if hasPrefixFold(query, "select count") {
+			return &fakeResponse{columns: []string{"count(*)"}, rows: [][]driver.Value{{int64(2)}}}, nil
+		}
+		if len(args) > 0 && args[0].Value == int64(0) {
+			return &fakeResponse{columns: []string{"id"}}, nil
+		}
+		return &fakeResponse{
+			columns: []string{"id", "name", "remark", "nickname", "created_at", "unknown"},
+			rows: [][]driver.Value{
+				{int64(1), []byte("a"), nil, nil, []byte("2024-01-01"), int64(9)},
+				{int64(2), []byte("b"), []byte("r"), []byte("n"), []byte("2024-01-02"), int64(9)},
+			},
+		}, nil
+	})
+	executor := fakeGetDB{db: db}
+	ctx := context.Background()
+	t.Run("query", func(t *testing.T) {
+		services, err := sqlexec.Query[Service](ctx, executor, "select * from service where id>?", 1)
+		require.NoError(t, err)
+		require.Len(t, services, 2)
+		assert.Equal(t, int64(1), services[0].ID)
+		assert.Equal(t, "a", services[0].Name)
+		assert.Nil(t, services[0].Remark)
+		assert.False(t, services[0].Nickname.Valid)
+		assert.Equal(t, "2024-01-01", services[0].CreatedAt)
+		require.NotNil(t, services[1].Remark)
+		assert.Equal(t, "r", *services[1].Remark)
+		assert.Equal(t, "n", services[1].Nickname.String)
+	})
+	t.Run("query one", func(t *testing.T) {
+		service, err := sqlexec.QueryOne[*Service](ctx, executor, "select * from service where id=?", 1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), service.ID)
+	})
+	t.Run("no rows", func(t *testing.T) {
+		_, err := sqlexec.QueryOne[Service](ctx, executor, "select * from service where id=?", 0)
+		require.ErrorIs(t, err, sqlexec.ErrNoRows)
+	})
+	t.Run("scalar", func(t *testing.T) {
+		count, err := sqlexec.QueryOne[int](ctx, executor, "select count(*) from service")
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+}
@@ -0,0 +1,310 @@
+package sqlexec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blastrain/vitess-sqlparser/sqlparser"
+	"github.com/pkg/errors"
+)
+
+// ErrGuardrail 语句违反 GuardrailPolicy,未发送到数据库,详细信息见 *GuardrailError
+var ErrGuardrail = errors.New("guardrail violated")
+
+// GuardrailRule 语句检查规则
+type GuardrailRule string
+
+const (
+	GuardrailRule_ReadOnly     GuardrailRule = "read_only"     // 只读模式拒绝所有写语句
+	GuardrailRule_ForbidDDL    GuardrailRule = "forbid_ddl"    // 拒绝 create、alter、drop 及 optimize 等表维护语句
+	GuardrailRule_RequireWhere GuardrailRule = "require_where" // update、delete 必须有 where 条件,且条件不能恒为真
+	GuardrailRule_RequireLimit GuardrailRule = "require_limit" // select 必须有 limit
+	GuardrailRule_MaxInList    GuardrailRule = "max_in_list"   // in 列表的元素数上限
+)
+
+// GuardrailError 违反的规则及原因
+type GuardrailError struct {
+	Rule   GuardrailRule
+	Reason string
+	SQL    string
+}
+
+func (e *GuardrailError) Error() string {
+	return fmt.Sprintf("%s: rule %s, %s, sql:%s", ErrGuardrail.Error(), e.Rule, e.Reason, e.SQL)
+}
+
+func (e *GuardrailError) Is(target error) bool {
+	return target == ErrGuardrail
+}
+
+// GuardrailPolicy 执行前基于语法树检查语句,零值不做任何检查
+type GuardrailPolicy struct {
+	ReadOnly      bool `json:"readOnly"`      // 拒绝 insert、replace、update、delete、ddl(含 optimize 等表维护语句)、call 及无法识别、无法解析的语句
+	ForbidDDL     bool `json:"forbidDDL"`     // 拒绝 ddl 及表维护语句,适用于业务 executor
+	RequireWhere  bool `json:"requireWhere"`  // update、delete 必须有 where 条件,1=1、1、true 等恒为真的条件视为没有条件;无法解析的 update、delete 同样拒绝
+	RequireLimit  bool `json:"requireLimit"`  // select 没有 limit 时拒绝,设置 DefaultLimit 时改为追加 limit
+	DefaultLimit  int  `json:"defaultLimit"`  // select 没有 limit 时追加 limit DefaultLimit,0 不追加;没有 from、只返回一行聚合结果的查询除外
+	MaxInListSize int  `json:"maxInListSize"` // in 列表最多元素数,0 不限制
+}
+
+// check 检查语句,需要追加 limit 时返回改写后的sql
+func (p GuardrailPolicy) check(call *StatementCall) (sqls string, err error) {
+	sqls = call.SQL
+	violate := func(rule GuardrailRule, format string, args ...any) error {
+		return &GuardrailError{Rule: rule, Reason: fmt.Sprintf(format, args...), SQL: call.SQL}
+	}
+	unparsed := call.AST == nil && call.Type != StatementType_Show && call.Type != StatementType_Set // 无法确认只读的语句按写语句处理,如 with ... delete
+	switch call.Type {
+	case StatementType_Select, StatementType_Show, StatementType_Set:
+		if p.ReadOnly && unparsed {
+			return "", violate(GuardrailRule_ReadOnly, "unable to parse %s statement in read only mode", call.Type)
+		}
+	case StatementType_DDL, StatementType_Maintenance:
+		if p.ReadOnly {
+			return "", violate(GuardrailRule_ReadOnly, "%s statement in read only mode", call.Type)
+		}
+		if p.ForbidDDL {
+			return "", violate(GuardrailRule_ForbidDDL, "%s statement is forbidden", call.Type)
+		}
+	case "":
+		if p.ReadOnly {
+			return "", violate(GuardrailRule_ReadOnly, "unrecognized statement in read only mode")
+		}
+	default:
+		if p.ReadOnly {
+			return "", violate(GuardrailRule_ReadOnly, "%s statement in read only mode", call.Type)
+		}
+	}
+	if p.RequireWhere && (call.Type == StatementType_Update || call.Type == StatementType_Delete) { // with ... update/delete 的类型同样为 update、delete
+		var where *sqlparser.Where
+		switch ast := call.AST.(type) {
+		case *sqlparser.Update:
+			where = ast.Where
+		case *sqlparser.Delete:
+			where = ast.Where
+		default:
+			return "", violate(GuardrailRule_RequireWhere, "unable to parse %s statement", call.Type)
+		}
+		if where == nil {
+			return "", violate(GuardrailRule_RequireWhere, "%s without where", call.Type)
+		}
+		if isTautology(where.Expr) {
+			return "", violate(GuardrailRule_RequireWhere, "%s with always true where: %s", call.Type, sqlparser.String(where.Expr))
+		}
+	}
+	if p.MaxInListSize > 0 && call.AST != nil {
+		size := maxInListSize(call.AST)
+		if size > p.MaxInListSize {
+			return "", violate(GuardrailRule_MaxInList, "in list size %d exceeds %d", size, p.MaxInListSize)
+		}
+	}
+	if (p.RequireLimit || p.DefaultLimit > 0) && call.Type == StatementType_Select && needLimit(call) {
+		if p.DefaultLimit <= 0 {
+			return "", violate(GuardrailRule_RequireLimit, "select without limit")
+		}
+		sqls = appendLimit(sqls, p.DefaultLimit)
+	}
+	return sqls, nil
+}
+
+// isTautology where 条件是否恒为真:非零常量、true、常量比较成立、列与自身相等,及由它们组成的 and、or
+func isTautology(expr sqlparser.Expr) bool {
+	switch expr := expr.(type) {
+	case *sqlparser.ParenExpr:
+		return isTautology(expr.Expr)
+	case *sqlparser.OrExpr:
+		return isTautology(expr.Left) || isTautology(expr.Right)
+	case *sqlparser.AndExpr:
+		return isTautology(expr.Left) && isTautology(expr.Right)
+	case sqlparser.BoolVal:
+		return bool(expr)
+	case *sqlparser.SQLVal:
+		f, ok := constNumber(expr)
+		return ok && f != 0
+	case *sqlparser.ComparisonExpr:
+		if left, ok := expr.Left.(*sqlparser.ColName); ok {
+			right, ok := expr.Right.(*sqlparser.ColName)
+			return ok && expr.Operator == sqlparser.EqualStr && sqlparser.String(left) == sqlparser.String(right)
+		}
+		left, ok1 := expr.Left.(*sqlparser.SQLVal)
+		right, ok2 := expr.Right.(*sqlparser.SQLVal)
+		if !ok1 || !ok2 {
+			return false
+		}
+		cmp, ok := compareConst(left, right)
+		if !ok {
+			return false
+		}
+		switch expr.Operator {
+		case sqlparser.EqualStr, sqlparser.NullSafeEqualStr:
+			return cmp == 0
+		case sqlparser.NotEqualStr:
+			return cmp != 0
+		case sqlparser.LessThanStr:
+			return cmp < 0
+		case sqlparser.LessEqualStr:
+			return cmp <= 0
+		case sqlparser.GreaterThanStr:
+			return cmp > 0
+		case sqlparser.GreaterEqualStr:
+			return cmp >= 0
+		}
+	}
+	return false
+}
+
+// constNumber 常量的数值,字符串只识别完整的数字(如 '1')
+func constNumber(val *sqlparser.SQLVal) (f float64, ok bool) {
+	switch val.Type {
+	case sqlparser.IntVal, sqlparser.FloatVal, sqlparser.StrVal:
+		f, err := strconv.ParseFloat(string(val.Val), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// compareConst 比较两个常量,两边都是数字时按数值比较,都是字符串时按字节比较;包含占位符等非常量时返回false
+func compareConst(left *sqlparser.SQLVal, right *sqlparser.SQLVal) (cmp int, ok bool) {
+	if left.Type == sqlparser.StrVal && right.Type == sqlparser.StrVal {
+		return bytes.Compare(left.Val, right.Val), true
+	}
+	l, ok1 := constNumber(left)
+	r, ok2 := constNumber(right)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	switch {
+	case l < r:
+		return -1, true
+	case l > r:
+		return 1, true
+	}
+	return 0, true
+}
+
+// maxInListSize 语句中最长的 in、not in 列表的元素数
+func maxInListSize(ast sqlparser.Statement) (size int) {
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		expr, ok := node.(*sqlparser.ComparisonExpr)
+		if !ok || (expr.Operator != sqlparser.InStr && expr.Operator != sqlparser.NotInStr) {
+			return true, nil
+		}
+		if tuple, ok := expr.Right.(sqlparser.ValTuple); ok && len(tuple) > size {
+			size = len(tuple)
+		}
+		return true, nil
+	}, ast)
+	return size
+}
+
+// needLimit select 是否缺少 limit;没有语法树、没有from(或只有dual)、没有 group by 且只查询聚合函数的语句不需要
+func needLimit(call *StatementCall) bool {
+	if len(call.Tables) == 0 || (len(call.Tables) == 1 && strings.EqualFold(call.Tables[0], "dual")) {
+		return false
+	}
+	ast := call.AST
+	for {
+		paren, ok := ast.(*sqlparser.ParenSelect)
+		if !ok {
+			break
+		}
+		ast = paren.Select
+	}
+	switch ast := ast.(type) {
+	case *sqlparser.Union:
+		return ast.Limit == nil
+	case *sqlparser.Select:
+		if ast.Limit != nil {
+			return false
+		}
+		if len(ast.GroupBy) > 0 {
+			return true
+		}
+		for _, selectExpr := range ast.SelectExprs {
+			aliased, ok := selectExpr.(*sqlparser.AliasedExpr)
+			if !ok {
+				return true
+			}
+			if fn, ok := aliased.Expr.(*sqlparser.FuncExpr); !ok || !fn.IsAggregate() {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// appendLimit 在语句末尾(加锁读时在 for update 等之前)追加 limit
+func appendLimit(sqls string, limit int) string {
+	clause := fmt.Sprintf("limit %d", limit)
+	if loc := lockingReadRegexp.FindStringIndex(sqls); loc != nil {
+		return sqls[:loc[0]] + clause + " " + sqls[loc[0]:]
+	}
+	return AppendSQLComment(sqls, clause)
+}
+
+// GuardrailMiddleware 按policy 检查语句,违反规则时返回 *GuardrailError,需要时追加 limit;
+// 中间件改写过sql 时重新解析,检查的是实际发送的语句
+func GuardrailMiddleware(policy GuardrailPolicy) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *StatementCall) (output StatementOutput, err error) {
+			if call.SQL != call.parsedSQL {
+				reparsed := newStatementCall(ctx, call.DB, call.Kind, call.SQL, call.Args, call.TxID)
+				call.Type, call.AST, call.Tables, call.parsedSQL = reparsed.Type, reparsed.AST, reparsed.Tables, reparsed.parsedSQL
+			}
+			sqls, err := policy.check(call)
+			if err != nil {
+				return output, err
+			}
+			call.SQL = sqls
+			return next(ctx, call)
+		}
+	}
+}
+
+const (
+	context_Key_Guardrails contextKey = "sqlexec_guardrails"
+)
+
+// WithGuardrails 设置本次调用的语句检查策略,优先级高于 ExecutorSQL.SetGuardrails;policy 为nil 时不检查
+func WithGuardrails(ctx context.Context, policy *GuardrailPolicy) context.Context {
+	return context.WithValue(ctx, context_Key_Guardrails, policy)
+}
+
+func guardrailsFromContext(ctx context.Context) (policy *GuardrailPolicy, ok bool) {
+	policy, ok = ctx.Value(context_Key_Guardrails).(*GuardrailPolicy)
+	return policy, ok
+}
+
+// SetGuardrails 设置语句检查策略,在所有中间件之后、发送到数据库之前检查;DBConfig.ReadOnly 为true 时始终开启只读检查
+func (e *ExecutorSQL) SetGuardrails(policy GuardrailPolicy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.guardrails = &policy
+}
+
+// withGuardrails 将executor 的语句检查策略写入ctx,调用方已设置的优先;DBConfig.ReadOnly 为true 时总是加上只读检查
+func (e *ExecutorSQL) withGuardrails(ctx context.Context) context.Context {
+	policy, ok := guardrailsFromContext(ctx)
+	e.mu.Lock()
+	if !ok {
+		policy = e.guardrails
+	}
+	readOnly := e.dbConfig.ReadOnly
+	e.mu.Unlock()
+	if readOnly && (policy == nil || !policy.ReadOnly) {
+		merged := GuardrailPolicy{ReadOnly: true}
+		if policy != nil {
+			merged = *policy
+			merged.ReadOnly = true
+		}
+		policy = &merged
+	}
+	if policy == nil {
+		return ctx
+	}
+	return WithGuardrails(ctx, policy)
+}
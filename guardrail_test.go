@@ -0,0 +1,128 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestExecutorSQLGuardrails(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeServer(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		return &fakeResponse{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), []byte("a")}}, rowsAffected: 1}, nil
+	})
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: t.Name()}, nil)
+	executor.SetGuardrails(sqlexec.GuardrailPolicy{ForbidDDL: true, RequireWhere: true, DefaultLimit: 100, MaxInListSize: 3})
+	t.Cleanup(func() { executor.Close() })
+	exec := func(sqls string) error {
+		var out any
+		return executor.ExecOrQueryContext(ctx, sqls, &out)
+	}
+	lastSQL := func() string {
+		log := server.Log()
+		return log[len(log)-1]
+	}
+
+	rejected := map[string]sqlexec.GuardrailRule{
+		"update service set name='a'":                           sqlexec.GuardrailRule_RequireWhere,
+		"delete from service":                                   sqlexec.GuardrailRule_RequireWhere,
+		"delete from service where 1=1":                         sqlexec.GuardrailRule_RequireWhere,
+		"update service set name='a' where 1":                   sqlexec.GuardrailRule_RequireWhere,
+		"update service set name='a' where true":                sqlexec.GuardrailRule_RequireWhere,
+		"update service set name='a' where 'x'='x'":             sqlexec.GuardrailRule_RequireWhere,
+		"update service set name='a' where id=id":               sqlexec.GuardrailRule_RequireWhere,
+		"update service set name='a' where (1=1 or id=2)":       sqlexec.GuardrailRule_RequireWhere,
+		"update service set name='a' where 1<>2 limit 1":        sqlexec.GuardrailRule_RequireWhere,
+		"drop table service":                                    sqlexec.GuardrailRule_ForbidDDL,
+		"optimize table service":                                sqlexec.GuardrailRule_ForbidDDL,
+		"with x as (select 1) delete from service":              sqlexec.GuardrailRule_RequireWhere,
+		"select id,name from service where id in (1,2,3,4)":     sqlexec.GuardrailRule_MaxInList,
+		"delete from service where id not in (1,2,3,4) limit 1": sqlexec.GuardrailRule_MaxInList,
+	}
+	for sqls, rule := range rejected {
+		err := exec(sqls)
+		require.ErrorIs(t, err, sqlexec.ErrGuardrail, sqls)
+		var guardrailErr *sqlexec.GuardrailError
+		require.ErrorAs(t, err, &guardrailErr)
+		assert.Equal(t, rule, guardrailErr.Rule, sqls)
+		assert.Contains(t, err.Error(), string(rule))
+	}
+	assert.Empty(t, server.Log(), "违反规则的语句不执行")
+
+	for _, sqls := range []string{
+		"update service set name='a' where id=1",
+		"update service set name='a' where 1=1 and id=1",
+		"delete from service where id=1 or 1=0",
+		"select id,name from service where id in (1,2,3) limit 10",
+		"select count(*) from service",
+		"select 1",
+		"with x as (select 1) select * from x",
+	} {
+		require.NoError(t, exec(sqls), sqls)
+		assert.Equal(t, sqls, lastSQL())
+	}
+
+	defaultLimit := map[string]string{
+		"select id,name from service;":                       "select id,name from service limit 100;",
+		"select id,name from service where id=1 for update":  "select id,name from service where id=1 limit 100 for update",
+		"select name,count(*) from service group by name":    "select name,count(*) from service group by name limit 100",
+		"select id from a union select id from b -- comment": "select id from a union select id from b -- comment\nlimit 100",
+	}
+	for sqls, expected := range defaultLimit {
+		require.NoError(t, exec(sqls), sqls)
+		assert.Equal(t, expected, lastSQL())
+	}
+
+	t.Run("require limit", func(t *testing.T) {
+		ctx := sqlexec.WithGuardrails(ctx, &sqlexec.GuardrailPolicy{RequireLimit: true})
+		var out any
+		err := executor.ExecOrQueryContext(ctx, "select id,name from service", &out)
+		var guardrailErr *sqlexec.GuardrailError
+		require.ErrorAs(t, err, &guardrailErr)
+		assert.Equal(t, sqlexec.GuardrailRule_RequireLimit, guardrailErr.Rule)
+		require.NoError(t, executor.ExecOrQueryContext(sqlexec.WithGuardrails(ctx, nil), "select id,name from service", &out))
+	})
+}
+
+func TestExecutorSQLReadOnly(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeServer(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		return &fakeResponse{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), []byte("a")}}, rowsAffected: 1}, nil
+	})
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: t.Name(), ReadOnly: true}, nil)
+	t.Cleanup(func() { executor.Close() })
+
+	for _, sqls := range []string{
+		"insert into service (name) values ('a')",
+		"replace into service (id,name) values (1,'a')",
+		"update service set name='a' where id=1",
+		"delete from service where id=1",
+		"create table t (id int)",
+		"call clean_service()",
+		"optimize table service",
+		"with x as (select 1) delete from service",
+		"with x as (select 1) select * from x",
+	} {
+		var out any
+		err := executor.ExecOrQueryContext(ctx, sqls, &out)
+		var guardrailErr *sqlexec.GuardrailError
+		require.ErrorAs(t, err, &guardrailErr, sqls)
+		assert.Equal(t, sqlexec.GuardrailRule_ReadOnly, guardrailErr.Rule)
+	}
+	_, _, err := sqlexec.Exec(ctx, executor, "update service set name='a' where id=1")
+	assert.ErrorIs(t, err, sqlexec.ErrGuardrail)
+	// ctx 中的策略不能取消只读
+	var out any
+	err = executor.ExecOrQueryContext(sqlexec.WithGuardrails(ctx, &sqlexec.GuardrailPolicy{}), "delete from service where id=1", &out)
+	assert.ErrorIs(t, err, sqlexec.ErrGuardrail)
+	assert.Empty(t, server.Log())
+
+	var records []map[string]string
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "select id,name from service", &records))
+	assert.Equal(t, []map[string]string{{"id": "1", "name": "a"}}, records)
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "show tables", &records))
+}
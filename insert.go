@@ -0,0 +1,147 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/blastrain/vitess-sqlparser/sqlparser"
+)
+
+// InsertResult insert/replace 语句的执行结果
+type InsertResult struct {
+	FirstId       int64   `json:"firstId"`             // 数据库返回的 LAST_INSERT_ID,即第一条插入记录的自增id
+	InsertedCount int64   `json:"insertedCount"`       // 新插入的记录数
+	UpdatedCount  int64   `json:"updatedCount"`        // on duplicate key update 更新的记录数,replace 替换的记录数
+	IgnoredCount  int64   `json:"ignoredCount"`        // insert ignore 忽略的记录数,on duplicate key update 值未变化的记录数
+	Ids           []int64 `json:"ids"`                 // 插入记录的自增id,仅在所有记录都是新插入时可以确定,否则为空
+	RowsAffected  int64   `json:"rowsAffected"`        // 数据库返回的原始影响行数
+	Estimated     bool    `json:"estimated,omitempty"` // 插入、更新、忽略的记录数为推算值,多行 on duplicate key update 时无法从影响行数精确区分
+}
+
+// insertInfo 从语法树中获取的insert 语句信息
+type insertInfo struct {
+	rowCount int64 // values 中的记录数,insert ... select 时为0(未知)
+	ignore   bool
+	upsert   bool
+	replace  bool
+}
+
+func getInsertInfo(stmt *Statement) (info insertInfo) {
+	info.replace = stmt.Type == StatementType_Replace
+	insert, ok := stmt.AST.(*sqlparser.Insert)
+	if !ok {
+		return info
+	}
+	info.replace = insert.Action == sqlparser.ReplaceStr
+	info.ignore = insert.Ignore != ""
+	info.upsert = len(insert.OnDup) > 0
+	if values, ok := insert.Rows.(sqlparser.Values); ok {
+		info.rowCount = int64(len(values))
+	}
+	return info
+}
+
+// InsertContext 执行insert/replace 语句,根据语句类型(ignore、on duplicate key update、replace)和 @@auto_increment_increment 计算插入结果
+func InsertContext(ctx context.Context, db *sql.DB, sqls string, args ...any) (result *InsertResult, err error) {
+	ctx, stmt, err := withParsedStatement(ctx, sqls)
+	if err != nil {
+		return nil, err
+	}
+	return insertContext(ctx, db, stmt, args...)
+}
+
+func insertContext(ctx context.Context, db *sql.DB, stmt *Statement, args ...any) (result *InsertResult, err error) {
+	info := getInsertInfo(stmt)
+	if info.rowCount > 1 { // 自增步长是会话变量,多行插入后在同一个连接上读取
+		var release func()
+		ctx, release, err = pinConn(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+	lastInsertId, rowsAffected, err := ExecContext(ctx, db, stmt.SQL, args...)
+	if err != nil {
+		return nil, err
+	}
+	result = newInsertResult(info, lastInsertId, rowsAffected)
+	if result.FirstId == 0 || result.InsertedCount == 0 || result.Estimated {
+		return result, nil
+	}
+	allInserted := result.IgnoredCount == 0 && (info.replace || result.UpdatedCount == 0) // replace 替换的记录也会分配新的自增id
+	if info.rowCount == 0 { // insert ... select 等记录数未知的语句,自增id 可能不连续,只有一条时可以确定
+		allInserted = result.RowsAffected == 1
+	}
+	if !allInserted {
+		return result, nil
+	}
+	increment := int64(1)
+	if result.InsertedCount > 1 {
+		increment, err = getAutoIncrementIncrement(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result.Ids = make([]int64, 0, result.InsertedCount)
+	for i := int64(0); i < result.InsertedCount; i++ {
+		result.Ids = append(result.Ids, result.FirstId+i*increment)
+	}
+	return result, nil
+}
+
+// newInsertResult 根据影响行数推算插入、更新、忽略的记录数:
+// on duplicate key update 每条插入计1,更新计2,值未变化计0;replace 每条替换计2(删除+插入)
+func newInsertResult(info insertInfo, lastInsertId int64, rowsAffected int64) (result *InsertResult) {
+	result = &InsertResult{
+		FirstId:       lastInsertId,
+		InsertedCount: rowsAffected,
+		RowsAffected:  rowsAffected,
+		Ids:           make([]int64, 0),
+	}
+	n := info.rowCount
+	if n == 0 { // 记录数未知,无法推算
+		return result
+	}
+	switch {
+	case info.replace:
+		result.InsertedCount = n
+		result.UpdatedCount = max(rowsAffected-n, 0)
+	case info.upsert:
+		result.Estimated = n > 1 // 多行时 2 条插入与 1 条更新+1 条未变化的影响行数相同
+		if rowsAffected >= n {   // 假设没有值未变化的记录
+			result.UpdatedCount = rowsAffected - n
+			result.InsertedCount = n - result.UpdatedCount
+		} else { // 存在值未变化的记录,假设没有更新的记录
+			result.InsertedCount = rowsAffected
+			result.IgnoredCount = n - rowsAffected
+		}
+	case info.ignore:
+		result.IgnoredCount = max(n-rowsAffected, 0)
+	}
+	return result
+}
+
+// getAutoIncrementIncrement 在执行插入的连接上获取自增步长,ctx 中需要有db 的事务或固定连接
+func getAutoIncrementIncrement(ctx context.Context, db *sql.DB) (increment int64, err error) {
+	executor, _ := getSQLExecutor(ctx, db)
+	rows, err := executor.QueryContext(ctx, "SELECT @@auto_increment_increment")
+	if err != nil {
+		recordConnFailure(ctx, db, err)
+		return 0, err
+	}
+	defer rows.Close()
+	increment = 1
+	if rows.Next() {
+		err = rows.Scan(&increment)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if increment < 1 {
+		increment = 1
+	}
+	return increment, nil
+}
@@ -0,0 +1,74 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestInsertContext(t *testing.T) {
+	ctx := context.Background()
+	newDB := func(t *testing.T, rowsAffected int64, increment int64) *sql.DB {
+		db, _ := openFakeDB(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+			if strings.Contains(query, "@@auto_increment_increment") {
+				return &fakeResponse{columns: []string{"@@auto_increment_increment"}, rows: [][]driver.Value{{increment}}}, nil
+			}
+			return &fakeResponse{lastInsertId: 10, rowsAffected: rowsAffected}, nil
+		})
+		return db
+	}
+	t.Run("auto_increment_increment", func(t *testing.T) {
+		db := newDB(t, 3, 2)
+		result, err := sqlexec.InsertContext(ctx, db, "insert into service (name) values('a'),('b'),('c')")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), result.InsertedCount)
+		assert.Equal(t, []int64{10, 12, 14}, result.Ids)
+	})
+	t.Run("same connection", func(t *testing.T) { // 自增步长是会话变量,每次在执行插入的连接上读取
+		db, server := openFakeDB(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+			if strings.Contains(query, "@@auto_increment_increment") {
+				return &fakeResponse{columns: []string{"@@auto_increment_increment"}, rows: [][]driver.Value{{int64(2)}}}, nil
+			}
+			return &fakeResponse{lastInsertId: 10, rowsAffected: 2}, nil
+		})
+		db.SetMaxIdleConns(0) // 连接用完即关闭,未固定连接时每条语句重新建立连接
+		for i := 0; i < 2; i++ {
+			result, err := sqlexec.InsertContext(ctx, db, "insert into service (name) values('a'),('b')")
+			require.NoError(t, err)
+			assert.Equal(t, []int64{10, 12}, result.Ids)
+		}
+		assert.Equal(t, int64(2), server.Dials())
+		assert.Len(t, server.Log(), 4)
+	})
+	t.Run("upsert update", func(t *testing.T) {
+		db := newDB(t, 2, 1)
+		result, err := sqlexec.InsertContext(ctx, db, "insert into service (id,name) values(1,'a') on duplicate key update name=values(name)")
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), result.InsertedCount)
+		assert.Equal(t, int64(1), result.UpdatedCount)
+		assert.False(t, result.Estimated)
+		assert.Empty(t, result.Ids)
+	})
+	t.Run("multi-row upsert", func(t *testing.T) {
+		db := newDB(t, 2, 1) // 2 条插入,或 1 条更新+1 条值未变化
+		result, err := sqlexec.InsertContext(ctx, db, "insert into service (id,name) values(1,'a'),(2,'b') on duplicate key update name=values(name)")
+		require.NoError(t, err)
+		assert.True(t, result.Estimated)
+		assert.Empty(t, result.Ids)
+		assert.Equal(t, int64(2), result.RowsAffected)
+	})
+	t.Run("ignore", func(t *testing.T) {
+		db := newDB(t, 1, 1)
+		result, err := sqlexec.InsertContext(ctx, db, "insert ignore into service (name) values('a'),('b')")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), result.InsertedCount)
+		assert.Equal(t, int64(1), result.IgnoredCount)
+		assert.Empty(t, result.Ids)
+	})
+}
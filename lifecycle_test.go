@@ -0,0 +1,111 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func init() {
+	sqlexec.DriverName = fakeDriverName
+}
+
+func TestExecutorSQLLifecycle(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeServer(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		return &fakeResponse{columns: []string{"count"}, rows: [][]driver.Value{{int64(2)}}}, nil
+	})
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: t.Name()}, nil)
+	executor.SetBackoffPolicy(sqlexec.BackoffPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond})
+
+	server.SetDown(true)
+	_, err := executor.GetDB()
+	require.Error(t, err)
+	assert.True(t, sqlexec.IsNetworkError(err))
+	assert.Equal(t, int64(3), server.Dials())
+	require.Error(t, executor.Ping(ctx))
+
+	server.SetDown(false) // 失败后再次调用重新连接
+	require.NoError(t, executor.Open(ctx))
+	require.NoError(t, executor.Ping(ctx))
+	var out int
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "select count(*) from service", &out))
+	assert.Equal(t, 2, out)
+
+	require.NoError(t, executor.Close())
+	require.NoError(t, executor.Close())
+	_, err = executor.GetDB()
+	require.ErrorIs(t, err, sqlexec.ERROR_EXECUTOR_CLOSED)
+	require.ErrorIs(t, executor.ExecOrQueryContext(ctx, "select count(*) from service", &out), sqlexec.ERROR_EXECUTOR_CLOSED)
+}
+
+func TestBackoffPolicy(t *testing.T) {
+	ctx := context.Background()
+	policy := sqlexec.BackoffPolicy{MaxAttempts: 4, InitialInterval: time.Millisecond, MaxInterval: 2 * time.Millisecond, Multiplier: 2}
+	t.Run("retry network error", func(t *testing.T) {
+		attempts := 0
+		err := policy.Do(ctx, func(ctx context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+	t.Run("max attempts", func(t *testing.T) {
+		attempts := 0
+		err := policy.Do(ctx, func(ctx context.Context) error {
+			attempts++
+			return driver.ErrBadConn
+		})
+		require.ErrorIs(t, err, driver.ErrBadConn)
+		assert.Equal(t, 4, attempts)
+	})
+	t.Run("not retryable", func(t *testing.T) {
+		attempts := 0
+		err := policy.Do(ctx, func(ctx context.Context) error {
+			attempts++
+			return errors.New("access denied")
+		})
+		require.Error(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+	t.Run("canceled", func(t *testing.T) {
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		attempts := 0
+		err := sqlexec.BackoffPolicy{MaxAttempts: 3, InitialInterval: time.Hour}.Do(cancelCtx, func(ctx context.Context) error {
+			attempts++
+			return mysql.ErrInvalidConn
+		})
+		require.ErrorIs(t, err, mysql.ErrInvalidConn)
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestIsNetworkError(t *testing.T) {
+	assert.True(t, sqlexec.IsNetworkError(errors.WithMessage(&net.OpError{Op: "dial", Err: errors.New("refused")}, "connect db")))
+	assert.True(t, sqlexec.IsNetworkError(driver.ErrBadConn))
+	assert.True(t, sqlexec.IsNetworkError(mysql.ErrInvalidConn))
+	assert.False(t, sqlexec.IsNetworkError(errors.New("Error 1045: Access denied")))
+	assert.False(t, sqlexec.IsNetworkError(nil))
+	assert.False(t, sqlexec.IsNetworkError(io.EOF))
+	assert.True(t, sqlexec.IsNetworkError(io.ErrUnexpectedEOF))
+	assert.False(t, sqlexec.IsNetworkError(context.Canceled))
+	assert.False(t, sqlexec.IsNetworkError(errors.WithMessage(context.DeadlineExceeded, "exec")))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	assert.False(t, sqlexec.IsNetworkError(ctx.Err()))
+}
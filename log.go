@@ -25,6 +25,8 @@ type LogInfoEXECSQL struct {
 	RowsAffected int64     `json:"affectedRows"`
 	LastInsertId int64     `json:"lastInsertId"`
 	Level        string    `json:"level"`
+	TxID         string    `json:"txId"`    // 所属事务ID,非事务为空
+	Attempt      int       `json:"attempt"` // 按 RetryPolicy 重试时为第几次执行,未重试为0或1
 	logchan.EmptyLogInfo
 }
 
@@ -46,6 +48,96 @@ const (
 	LOG_INFO_EXEC_SQL LogName = "LogInfoEXECSQL"
 )
 
+// LogLevel 控制输出哪些 LogInfoEXECSQL 日志
+type LogLevel string
+
+const (
+	LogLevel_Silent LogLevel = "silent" // 不输出
+	LogLevel_Error  LogLevel = "error"  // 只输出出错的语句
+	LogLevel_Slow   LogLevel = "slow"   // 输出慢语句和出错的语句
+	LogLevel_All    LogLevel = "all"    // 默认,输出所有语句
+)
+
+// DefaultSlowThreshold 默认慢语句阈值
+var DefaultSlowThreshold = time.Second
+
+const (
+	context_Key_LogLevel      contextKey = "sqlexec_log_level"
+	context_Key_SlowThreshold contextKey = "sqlexec_slow_threshold"
+)
+
+// IsValid 是否为支持的日志级别,空值按 LogLevel_All 处理
+func (l LogLevel) IsValid() bool {
+	switch l {
+	case "", LogLevel_Silent, LogLevel_Error, LogLevel_Slow, LogLevel_All:
+		return true
+	}
+	return false
+}
+
+// Allow 该级别是否输出语句日志
+func (l LogLevel) Allow(hasError bool, slow bool) bool {
+	switch l {
+	case LogLevel_Silent:
+		return false
+	case LogLevel_Error:
+		return hasError
+	case LogLevel_Slow:
+		return hasError || slow
+	}
+	return true
+}
+
+// WithLogLevel 设置本次调用的日志级别,优先级高于 DBConfig.LogLevel
+func WithLogLevel(ctx context.Context, level LogLevel) context.Context {
+	return context.WithValue(ctx, context_Key_LogLevel, level)
+}
+
+func logLevelFromContext(ctx context.Context) (level LogLevel, ok bool) {
+	level, ok = ctx.Value(context_Key_LogLevel).(LogLevel)
+	return level, ok
+}
+
+// WithSlowThreshold 设置本次调用的慢语句阈值,优先级高于 DBConfig.SlowThreshold
+func WithSlowThreshold(ctx context.Context, threshold time.Duration) context.Context {
+	return context.WithValue(ctx, context_Key_SlowThreshold, threshold)
+}
+
+func slowThresholdFromContext(ctx context.Context) (threshold time.Duration, ok bool) {
+	threshold, ok = ctx.Value(context_Key_SlowThreshold).(time.Duration)
+	return threshold, ok
+}
+
+// isSlow 耗时是否超过ctx 中的慢语句阈值,未记录开始时间时返回false
+func isSlow(ctx context.Context, beginAt time.Time, endAt time.Time) bool {
+	threshold, ok := slowThresholdFromContext(ctx)
+	if !ok || threshold <= 0 {
+		threshold = DefaultSlowThreshold
+	}
+	return !beginAt.IsZero() && endAt.Sub(beginAt) >= threshold
+}
+
+// sendLogInfoEXECSQL 按日志级别发送日志,同时设置 Level:出错为error,慢语句为warn,其它为info;Attempt 未设置时取ctx 中的执行次数
+func sendLogInfoEXECSQL(ctx context.Context, logInfo *LogInfoEXECSQL) {
+	if logInfo.Attempt == 0 {
+		logInfo.Attempt = attemptFromContext(ctx)
+	}
+	slow := isSlow(ctx, logInfo.BeginAt, logInfo.EndAt)
+	switch {
+	case logInfo.Err != nil:
+		logInfo.Level = "error"
+	case slow:
+		logInfo.Level = "warn"
+	default:
+		logInfo.Level = "info"
+	}
+	level, _ := logLevelFromContext(ctx)
+	if !level.Allow(logInfo.Err != nil, slow) {
+		return
+	}
+	logchan.SendLogInfo(logInfo)
+}
+
 // DefaultPrintLogInfoEXECSQL 默认日志打印函数
 func DefaultPrintLogInfoEXECSQL(logInfo logchan.LogInforInterface, typeName logchan.LogName, err error) {
 	if typeName != LOG_INFO_EXEC_SQL {
@@ -55,14 +147,21 @@ func DefaultPrintLogInfoEXECSQL(logInfo logchan.LogInforInterface, typeName logc
 	if !ok {
 		return
 	}
+	txInfo := ""
+	if logInfoEXECSQL.TxID != "" {
+		txInfo = fmt.Sprintf("|tx:%s", logInfoEXECSQL.TxID)
+	}
+	if logInfoEXECSQL.Attempt > 1 {
+		txInfo = fmt.Sprintf("%s|attempt:%d", txInfo, logInfoEXECSQL.Attempt)
+	}
 	if err != nil {
-		_, err1 := fmt.Fprintf(logchan.LogWriter, "%s|loginInfo:%s|error:%s\n", logchan.DefaultPrintLog(logInfoEXECSQL), logInfoEXECSQL.SQL, err.Error())
+		_, err1 := fmt.Fprintf(logchan.LogWriter, "%s%s|loginInfo:%s|error:%s\n", logchan.DefaultPrintLog(logInfoEXECSQL), txInfo, logInfoEXECSQL.SQL, err.Error())
 		if err1 != nil {
 			fmt.Printf("err: DefaultPrintLogInfoEXECSQL fmt.Fprintf:%s\n", err1.Error())
 		}
 		return
 	}
-	_, err1 := fmt.Fprintf(logchan.LogWriter, "%s|SQL:%+s [%s rows:%d]\n", logchan.DefaultPrintLog(logInfoEXECSQL), logInfoEXECSQL.SQL, logInfoEXECSQL.Duration, logInfoEXECSQL.RowsAffected)
+	_, err1 := fmt.Fprintf(logchan.LogWriter, "%s%s|SQL:%+s [%s rows:%d]\n", logchan.DefaultPrintLog(logInfoEXECSQL), txInfo, logInfoEXECSQL.SQL, logInfoEXECSQL.Duration, logInfoEXECSQL.RowsAffected)
 	if err1 != nil {
 		fmt.Printf("err: DefaultPrintLogInfoEXECSQL fmt.Fprintf:%s\n", err1.Error())
 	}
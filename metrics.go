@@ -0,0 +1,324 @@
+package sqlexec
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+const (
+	context_Key_Metrics contextKey = "sqlexec_metrics"
+)
+
+// DefaultMetricsBuckets 默认语句耗时直方图分桶,单位秒
+var DefaultMetricsBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// statementLabels 语句耗时直方图标签
+type statementLabels struct {
+	database string
+	typ      StatementType
+	table    string
+}
+
+// errorLabels 错误计数标签,code 为mysql 错误号,非mysql 错误为 network、timeout、canceled、other
+type errorLabels struct {
+	database string
+	typ      StatementType
+	code     string
+}
+
+type histogram struct {
+	counts []uint64 // 与 buckets 一一对应,不累加,输出时累加
+	count  uint64
+	sum    float64
+}
+
+// MetricsCollector 按数据库、语句类型、表统计语句耗时和错误,并输出连接池指标;
+// 以 Prometheus 文本格式输出,不依赖任何指标库,可直接作为 http.Handler 使用
+type MetricsCollector struct {
+	buckets    []float64
+	mu         sync.Mutex
+	histograms map[statementLabels]*histogram
+	errors     map[errorLabels]uint64
+	executors  map[string]*ExecutorSQL
+}
+
+// NewMetricsCollector buckets 为耗时直方图分桶(秒),为空时使用 DefaultMetricsBuckets
+func NewMetricsCollector(buckets ...float64) (c *MetricsCollector) {
+	if len(buckets) == 0 {
+		buckets = DefaultMetricsBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &MetricsCollector{
+		buckets:    buckets,
+		histograms: make(map[statementLabels]*histogram),
+		errors:     make(map[errorLabels]uint64),
+		executors:  make(map[string]*ExecutorSQL),
+	}
+}
+
+// Register 统计 executor 执行的语句及连接池,database 为指标中的数据库标签;相同 database 再次注册时替换
+func (c *MetricsCollector) Register(database string, executor *ExecutorSQL) {
+	executor.setMetrics(&metricsRecorder{collector: c, database: database})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.executors[database] = executor
+}
+
+// Unregister 不再输出 database 的连接池指标,已统计的语句指标保留
+func (c *MetricsCollector) Unregister(database string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.executors, database)
+}
+
+// Observe 记录一次语句执行
+func (c *MetricsCollector) Observe(database string, typ StatementType, table string, duration time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	labels := statementLabels{database: database, typ: typ, table: table}
+	h, ok := c.histograms[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(c.buckets))}
+		c.histograms[labels] = h
+	}
+	seconds := duration.Seconds()
+	if i := sort.SearchFloat64s(c.buckets, seconds); i < len(c.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += seconds
+	if err != nil {
+		c.errors[errorLabels{database: database, typ: typ, code: errorCode(err)}]++
+	}
+}
+
+// errorCode 错误的指标标签值
+func errorCode(err error) string {
+	var mysqlErr *mysql.MySQLError
+	switch {
+	case errors.As(err, &mysqlErr):
+		return strconv.Itoa(int(mysqlErr.Number))
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case IsNetworkError(err):
+		return "network"
+	}
+	return "other"
+}
+
+// metricsRecorder executor 的指标记录器,通过ctx 传递给执行语句的函数
+type metricsRecorder struct {
+	collector *MetricsCollector
+	database  string
+}
+
+func withMetrics(ctx context.Context, recorder *metricsRecorder) context.Context {
+	return context.WithValue(ctx, context_Key_Metrics, recorder)
+}
+
+func metricsFromContext(ctx context.Context) (recorder *metricsRecorder, ok bool) {
+	recorder, ok = ctx.Value(context_Key_Metrics).(*metricsRecorder)
+	return recorder, ok && recorder != nil
+}
+
+// observe 按语句类型和主表记录,无法解析的语句类型为空
+func (m *metricsRecorder) observe(call *StatementCall, duration time.Duration, err error) {
+	m.collector.Observe(m.database, call.Type, statementTable(call.Tables), duration, err)
+}
+
+// statementTable 语句操作的第一个表,多表语句只取第一个以控制指标数量;没有语法树时返回空
+func statementTable(tables []string) (table string) {
+	if len(tables) > 0 {
+		return tables[0]
+	}
+	return ""
+}
+
+// ServeHTTP 以 Prometheus 文本格式输出所有指标
+func (c *MetricsCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = c.WriteTo(w)
+}
+
+// WriteTo 以 Prometheus 文本格式写入所有指标
+func (c *MetricsCollector) WriteTo(w io.Writer) (n int64, err error) {
+	pw := &promWriter{w: bufio.NewWriter(w)}
+	c.writeStatements(pw)
+	c.writePools(pw)
+	if pw.err == nil {
+		pw.err = pw.w.Flush()
+	}
+	return pw.n, pw.err
+}
+
+func (c *MetricsCollector) writeStatements(pw *promWriter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]statementLabels, 0, len(c.histograms))
+	for labels := range c.histograms {
+		keys = append(keys, labels)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.database != b.database {
+			return a.database < b.database
+		}
+		if a.typ != b.typ {
+			return a.typ < b.typ
+		}
+		return a.table < b.table
+	})
+	pw.header("sqlexec_statement_duration_seconds", "histogram", "SQL statement execution duration in seconds.")
+	for _, labels := range keys {
+		h := c.histograms[labels]
+		base := []string{"database", labels.database, "type", string(labels.typ), "table", labels.table}
+		cumulative := uint64(0)
+		for i, bound := range c.buckets {
+			cumulative += h.counts[i]
+			pw.sample("sqlexec_statement_duration_seconds_bucket", append(base, "le", formatFloat(bound)), float64(cumulative))
+		}
+		pw.sample("sqlexec_statement_duration_seconds_bucket", append(base, "le", "+Inf"), float64(h.count))
+		pw.sample("sqlexec_statement_duration_seconds_sum", base, h.sum)
+		pw.sample("sqlexec_statement_duration_seconds_count", base, float64(h.count))
+	}
+
+	errorKeys := make([]errorLabels, 0, len(c.errors))
+	for labels := range c.errors {
+		errorKeys = append(errorKeys, labels)
+	}
+	sort.Slice(errorKeys, func(i, j int) bool {
+		a, b := errorKeys[i], errorKeys[j]
+		if a.database != b.database {
+			return a.database < b.database
+		}
+		if a.typ != b.typ {
+			return a.typ < b.typ
+		}
+		return a.code < b.code
+	})
+	pw.header("sqlexec_statement_errors_total", "counter", "SQL statement errors by MySQL error number or error class.")
+	for _, labels := range errorKeys {
+		pw.sample("sqlexec_statement_errors_total", []string{"database", labels.database, "type", string(labels.typ), "code", labels.code}, float64(c.errors[labels]))
+	}
+}
+
+// poolMetric 连接池指标
+type poolMetric struct {
+	name  string
+	typ   string
+	help  string
+	value func(stats Stats) float64
+}
+
+var poolMetrics = []poolMetric{
+	{"sqlexec_pool_max_open_connections", "gauge", "Maximum number of open connections, 0 means unlimited.", func(s Stats) float64 { return float64(s.Pool.MaxOpenConnections) }},
+	{"sqlexec_pool_open_connections", "gauge", "Number of established connections both in use and idle.", func(s Stats) float64 { return float64(s.Pool.OpenConnections) }},
+	{"sqlexec_pool_in_use_connections", "gauge", "Number of connections currently in use.", func(s Stats) float64 { return float64(s.Pool.InUse) }},
+	{"sqlexec_pool_idle_connections", "gauge", "Number of idle connections.", func(s Stats) float64 { return float64(s.Pool.Idle) }},
+	{"sqlexec_pool_wait_count_total", "counter", "Total number of connections waited for.", func(s Stats) float64 { return float64(s.Pool.WaitCount) }},
+	{"sqlexec_pool_wait_duration_seconds_total", "counter", "Total time blocked waiting for a new connection.", func(s Stats) float64 { return s.Pool.WaitDuration.Seconds() }},
+	{"sqlexec_in_flight_statements", "gauge", "Number of statements currently executing.", func(s Stats) float64 { return float64(s.InFlight) }},
+	{"sqlexec_singleflight_hits_total", "counter", "Total number of queries served by a concurrent identical query.", func(s Stats) float64 { return float64(s.SingleflightHits) }},
+}
+
+func (c *MetricsCollector) writePools(pw *promWriter) {
+	c.mu.Lock()
+	databases := make([]string, 0, len(c.executors))
+	executors := make(map[string]*ExecutorSQL, len(c.executors))
+	for database, executor := range c.executors {
+		databases = append(databases, database)
+		executors[database] = executor
+	}
+	c.mu.Unlock()
+	sort.Strings(databases)
+	stats := make([]Stats, 0, len(databases))
+	for _, database := range databases {
+		stats = append(stats, executors[database].Stats()) // 不持有锁,Stats 会获取 executor 的锁
+	}
+	for _, metric := range poolMetrics {
+		pw.header(metric.name, metric.typ, metric.help)
+		for i, database := range databases {
+			pw.sample(metric.name, []string{"database", database}, metric.value(stats[i]))
+		}
+	}
+}
+
+// promWriter 写入 Prometheus 文本格式,记录第一个错误,出错后不再写入
+type promWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (pw *promWriter) printf(format string, args ...any) {
+	if pw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(pw.w, format, args...)
+	pw.n += int64(n)
+	pw.err = err
+}
+
+func (pw *promWriter) header(name string, typ string, help string) {
+	pw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample labels 为 name、value 交替排列
+func (pw *promWriter) sample(name string, labels []string, value float64) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelReplacer.Replace(labels[i+1])))
+	}
+	pw.printf("%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(value))
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// setMetrics 设置指标记录器,nil 表示不记录
+func (e *ExecutorSQL) setMetrics(recorder *metricsRecorder) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.metrics = recorder
+}
+
+func (e *ExecutorSQL) getMetrics() (recorder *metricsRecorder) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.metrics
+}
+
+// SetMetricsCollector 将已注册及之后注册的数据库以标识为数据库标签加入 collector,nil 表示停止加入新注册的数据库
+func (r *Registry) SetMetricsCollector(collector *MetricsCollector) {
+	r.mu.Lock()
+	r.metrics = collector
+	r.mu.Unlock()
+	if collector == nil {
+		return
+	}
+	r.Range(func(identity string, executor *ExecutorSQL) bool {
+		collector.Register(identity, executor)
+		return true
+	})
+}
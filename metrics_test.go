@@ -0,0 +1,64 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	ctx := context.Background()
+	newFakeServer(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		if strings.Contains(query, "duplicate") {
+			return nil, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+		}
+		return &fakeResponse{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), []byte("a")}}, rowsAffected: 1, lastInsertId: 1}, nil
+	})
+	collector := sqlexec.NewMetricsCollector(0.1, 1)
+	registry := sqlexec.NewRegistry()
+	t.Cleanup(func() { registry.CloseAll() })
+	registry.SetMetricsCollector(collector)
+	executor, err := registry.Register("main", sqlexec.DBConfig{DSN: t.Name()}, nil)
+	require.NoError(t, err)
+
+	var out []map[string]string
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "select s.id,s.name from service s join api a on a.service_id=s.id", &out))
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "select id,name from service where id=2", &out))
+	var rowsAffected int
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "update `api` set name='b'", &rowsAffected))
+	require.Error(t, executor.ExecOrQueryContext(ctx, "update `api` set name='duplicate'", &rowsAffected))
+	collector.Observe("other", sqlexec.StatementType_Select, `a"b`, 2*time.Second, nil)
+
+	recorder := httptest.NewRecorder()
+	collector.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# TYPE sqlexec_statement_duration_seconds histogram",
+		`sqlexec_statement_duration_seconds_bucket{database="main",type="select",table="service",le="+Inf"} 2`,
+		`sqlexec_statement_duration_seconds_count{database="main",type="select",table="service"} 2`,
+		`sqlexec_statement_duration_seconds_count{database="main",type="update",table="api"} 2`,
+		`sqlexec_statement_duration_seconds_bucket{database="other",type="select",table="a\"b",le="1"} 0`,
+		`sqlexec_statement_duration_seconds_sum{database="other",type="select",table="a\"b"} 2`,
+		`sqlexec_statement_errors_total{database="main",type="update",code="1062"} 1`,
+		`sqlexec_pool_open_connections{database="main"} 0`,
+		`sqlexec_in_flight_statements{database="main"} 0`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+
+	require.NoError(t, registry.Unregister("main"))
+	var buf strings.Builder
+	_, err = collector.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.NotContains(t, buf.String(), `sqlexec_pool_open_connections{database="main"}`)
+	assert.Contains(t, buf.String(), `sqlexec_statement_errors_total{database="main",type="update",code="1062"} 1`)
+}
@@ -0,0 +1,264 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/blastrain/vitess-sqlparser/sqlparser"
+	"github.com/pkg/errors"
+)
+
+// Executor 执行sql 的接口,ExecutorSQL 为默认实现
+type Executor interface {
+	GetDBI
+	ExecOrQueryContext(ctx context.Context, sqls string, out interface{}) (err error)
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) (err error)
+	Use(middlewares ...Middleware)
+}
+
+var _ Executor = (*ExecutorSQL)(nil)
+
+// CallKind 语句的执行方式
+type CallKind string
+
+const (
+	CallKind_Exec  CallKind = "exec"  // ExecContext,输出最后插入的id和影响行数
+	CallKind_Query CallKind = "query" // QueryContext,输出结果json,可合并相同的并发查询
+	CallKind_Rows  CallKind = "rows"  // 流式查询及泛型查询,行数据由调用方逐行读取
+)
+
+// StatementCall 待执行语句的描述,中间件可修改 SQL、Args 改写语句
+type StatementCall struct {
+	Kind   CallKind
+	SQL    string
+	Args   []any
+	Type   StatementType       // 无法识别的语句为空
+	AST    sqlparser.Statement // sqlparser 不支持的语句为nil
+	Tables []string
+	DB     *sql.DB
+	DBName string
+	TxID   string // 所属事务ID,非事务为空
+
+	parsedSQL string // Type、AST、Tables 对应的sql,用于判断中间件是否改写了sql
+}
+
+// StatementOutput 语句执行结果,Out 为 CallKind_Query 的结果json
+type StatementOutput struct {
+	Out          string
+	LastInsertId int64
+	RowsAffected int64
+}
+
+// Handler 执行语句
+type Handler func(ctx context.Context, call *StatementCall) (output StatementOutput, err error)
+
+// Middleware 包装 Handler,可以改写、拒绝、计时、缓存或模拟语句;不调用next 时语句不会发送到数据库,CallKind_Rows 此时没有行数据
+type Middleware func(next Handler) Handler
+
+// DefaultMiddlewares 默认中间件,依次为日志、合并查询
+var DefaultMiddlewares = []Middleware{LoggingMiddleware, SingleflightMiddleware}
+
+const (
+	context_Key_Middlewares contextKey = "sqlexec_middlewares"
+)
+
+// WithMiddlewares 设置本次调用的中间件(替换默认中间件),优先级高于 ExecutorSQL.Use
+func WithMiddlewares(ctx context.Context, middlewares ...Middleware) context.Context {
+	return context.WithValue(ctx, context_Key_Middlewares, middlewares)
+}
+
+func middlewaresFromContext(ctx context.Context) (middlewares []Middleware, ok bool) {
+	middlewares, ok = ctx.Value(context_Key_Middlewares).([]Middleware)
+	return middlewares, ok
+}
+
+// Use 在默认中间件之后追加中间件,先添加的在外层
+func (e *ExecutorSQL) Use(middlewares ...Middleware) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.middlewares == nil {
+		e.middlewares = append([]Middleware{}, DefaultMiddlewares...)
+	}
+	e.middlewares = append(e.middlewares, middlewares...)
+}
+
+// SetMiddlewares 替换全部中间件(包括默认中间件),可用于调整顺序或去掉日志、合并查询
+func (e *ExecutorSQL) SetMiddlewares(middlewares ...Middleware) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.middlewares = append([]Middleware{}, middlewares...)
+}
+
+func (e *ExecutorSQL) getMiddlewares() (middlewares []Middleware) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.middlewares
+}
+
+// chainMiddlewares 按顺序包装handler,第一个中间件在最外层
+func chainMiddlewares(middlewares []Middleware, handler Handler) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+const (
+	context_Key_Statement contextKey = "sqlexec_statement"
+)
+
+// parsedStatement 已解析的语句及解析错误,通过ctx 传递,同一条sql 在一次调用中只解析一次
+type parsedStatement struct {
+	sqls string
+	stmt *Statement
+	err  error
+}
+
+// withParsedStatement 解析语句(ctx 中已有时直接使用)并写入ctx
+func withParsedStatement(ctx context.Context, sqls string) (_ context.Context, stmt *Statement, err error) {
+	stmt, err = parseStatement(ctx, sqls)
+	ctx = context.WithValue(ctx, context_Key_Statement, &parsedStatement{sqls: sqls, stmt: stmt, err: err})
+	return ctx, stmt, err
+}
+
+// parseStatement ctx 中存在该sql 的解析结果时直接返回,否则解析
+func parseStatement(ctx context.Context, sqls string) (stmt *Statement, err error) {
+	if parsed, ok := ctx.Value(context_Key_Statement).(*parsedStatement); ok && parsed.sqls == sqls {
+		return parsed.stmt, parsed.err
+	}
+	return ParseStatement(sqls)
+}
+
+// newStatementCall 解析语句生成描述,解析失败时类型为空
+func newStatementCall(ctx context.Context, db *sql.DB, kind CallKind, sqls string, args []any, txID string) (call *StatementCall) {
+	call = &StatementCall{
+		Kind:   kind,
+		SQL:    sqls,
+		Args:   args,
+		Tables: make([]string, 0),
+		DB:     db,
+		DBName: dbNameFromContext(ctx),
+		TxID:   txID,
+
+		parsedSQL: sqls,
+	}
+	if stmt, err := parseStatement(ctx, sqls); err == nil {
+		call.Type, call.AST, call.Tables = stmt.Type, stmt.AST, stmt.Tables()
+	}
+	return call
+}
+
+// runStatement 经过熔断器、并发限制、中间件和语句检查执行语句,统计、追踪在最外层,被拒绝的语句同样记录;
+// 语句只解析一次,统计、追踪、中间件共用 StatementCall 中的解析结果
+func runStatement(ctx context.Context, db *sql.DB, kind CallKind, sqls string, args []any, handle func(rows *sql.Rows) (rowsAffected int64, err error)) (output StatementOutput, err error) {
+	executor, txID := getSQLExecutor(ctx, db)
+	call := newStatementCall(ctx, db, kind, sqls, args, txID)
+	beginAt := time.Now().Local()
+	end := beginStatement(ctx, call)
+	defer func() {
+		end(err, beginAt, time.Now().Local())
+	}()
+	ctx, span := startSpan(ctx, call)
+	defer func() {
+		span.End(SpanResult{RowsAffected: output.RowsAffected, Err: err})
+	}()
+	ctx, done, err := acquireResilience(ctx)
+	if err != nil {
+		return output, err
+	}
+	defer done()
+	middlewares, ok := middlewaresFromContext(ctx)
+	if !ok {
+		middlewares = DefaultMiddlewares
+	}
+	if policy, _ := guardrailsFromContext(ctx); policy != nil { // 最后检查,中间件改写后的语句同样受限制
+		middlewares = append(append(make([]Middleware, 0, len(middlewares)+1), middlewares...), GuardrailMiddleware(*policy))
+	}
+	handler := chainMiddlewares(middlewares, executeStatement(executor, handle))
+	output, err = handler(ctx, call)
+	err = ClassifyError(err, call.DBName, call.SQL)
+	return output, err
+}
+
+// executeStatement 最内层的 Handler,将语句发送到数据库
+func executeStatement(executor sqlExecutor, handle func(rows *sql.Rows) (rowsAffected int64, err error)) Handler {
+	return func(ctx context.Context, call *StatementCall) (output StatementOutput, err error) {
+		defer func() {
+			err = ClassifyError(err, call.DBName, call.SQL)
+		}()
+		stmtCtx, cancel := withStatementTimeout(ctx) // 合并查询时ctx 已脱离调用方,需要在此设置超时
+		defer cancel()
+		handled := false
+		beginAt := time.Now()
+		defer func() {
+			recordBreaker(ctx, err, time.Since(beginAt))
+			if err != nil && !handled { // 逐行处理的错误可能来自调用方,不作为连接错误
+				recordConnFailure(stmtCtx, call.DB, err)
+			}
+		}()
+		switch call.Kind {
+		case CallKind_Exec:
+			res, err := executor.ExecContext(stmtCtx, withSQLComment(ctx, call.SQL), call.Args...)
+			if err != nil {
+				return output, err
+			}
+			output.LastInsertId, _ = res.LastInsertId()
+			output.RowsAffected, _ = res.RowsAffected()
+			return output, nil
+		case CallKind_Query:
+			result, err := queryResult(stmtCtx, executor, getResultMode(ctx), withSQLComment(ctx, withMaxExecutionTimeHint(ctx, call.SQL)), call.Args...)
+			if err != nil {
+				return output, err
+			}
+			output.Out, output.RowsAffected = result.out, result.rowsAffected
+			return output, nil
+		case CallKind_Rows:
+			rows, err := executor.QueryContext(stmtCtx, withSQLComment(ctx, withMaxExecutionTimeHint(ctx, call.SQL)), call.Args...)
+			if err != nil {
+				return output, err
+			}
+			defer rows.Close()
+			handled = true
+			output.RowsAffected, err = handle(rows)
+			return output, err
+		}
+		err = errors.Errorf("unsupported call kind: %s", call.Kind)
+		return output, err
+	}
+}
+
+// LoggingMiddleware 发送 LogInfoEXECSQL 日志,记录改写后的sql
+func LoggingMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call *StatementCall) (output StatementOutput, err error) {
+		logInfo := &LogInfoEXECSQL{TxID: call.TxID, BeginAt: time.Now().Local()}
+		defer func() {
+			logInfo.EndAt = time.Now().Local()
+			logInfo.SQL = explainSQLArgs(call.SQL, call.Args...)
+			logInfo.Result = output.Out
+			logInfo.RowsAffected = output.RowsAffected
+			logInfo.LastInsertId = output.LastInsertId
+			logInfo.Err = ClassifyError(err, call.DBName, call.SQL)
+			sendLogInfoEXECSQL(ctx, logInfo)
+		}()
+		return next(ctx, call)
+	}
+}
+
+// SingleflightMiddleware 合并相同的并发查询,只处理 CallKind_Query,规则见 WithSingleflight
+func SingleflightMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call *StatementCall) (output StatementOutput, err error) {
+		if _, pinned := pinnedConnFromContext(ctx, call.DB); pinned || call.Kind != CallKind_Query || !useSingleflight(ctx, call.TxID, call.SQL) { // 固定连接上的会话状态可能不同,不合并
+			return next(ctx, call)
+		}
+		policy, _ := guardrailsFromContext(ctx)
+		key := singleflightKey(call.DB, call.TxID, getResultMode(ctx), policy, call.SQL, call.Args...)
+		v, err := doSingleflight(ctx, key, func(ctx context.Context) (any, error) {
+			return next(ctx, call)
+		})
+		if err != nil {
+			return output, err
+		}
+		return v.(StatementOutput), nil
+	}
+}
@@ -0,0 +1,120 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestExecutorSQLMiddleware(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeServer(t, "root:123@tcp(127.0.0.1:3306)/mw"+t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		return &fakeResponse{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), []byte("a")}}, rowsAffected: 2}, nil
+	})
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: "root:123@tcp(127.0.0.1:3306)/mw" + t.Name()}, nil)
+	t.Cleanup(func() { executor.Close() })
+
+	var calls []sqlexec.StatementCall
+	denied := errors.New("delete denied")
+	executor.Use(
+		func(next sqlexec.Handler) sqlexec.Handler { // 记录
+			return func(ctx context.Context, call *sqlexec.StatementCall) (sqlexec.StatementOutput, error) {
+				calls = append(calls, *call)
+				return next(ctx, call)
+			}
+		},
+		func(next sqlexec.Handler) sqlexec.Handler { // 拒绝
+			return func(ctx context.Context, call *sqlexec.StatementCall) (sqlexec.StatementOutput, error) {
+				if call.Type == sqlexec.StatementType_Delete {
+					return sqlexec.StatementOutput{}, denied
+				}
+				return next(ctx, call)
+			}
+		},
+		func(next sqlexec.Handler) sqlexec.Handler { // 改写
+			return func(ctx context.Context, call *sqlexec.StatementCall) (sqlexec.StatementOutput, error) {
+				if call.Type == sqlexec.StatementType_Update {
+					call.SQL = strings.Replace(call.SQL, "where", "where tenant_id=? and", 1)
+					call.Args = append([]any{int64(7)}, call.Args...)
+				}
+				return next(ctx, call)
+			}
+		},
+	)
+
+	var out []map[string]string
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "select id,name from service where id=1", &out))
+	assert.Equal(t, []map[string]string{{"id": "1", "name": "a"}}, out)
+	var rowsAffected int
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "update service set name='b' where id=1", &rowsAffected))
+	assert.Equal(t, 2, rowsAffected)
+	err := executor.ExecOrQueryContext(ctx, "delete from service where id=1", &rowsAffected)
+	assert.ErrorIs(t, err, denied)
+
+	require.Len(t, calls, 3)
+	query := calls[0]
+	assert.Equal(t, sqlexec.CallKind_Query, query.Kind)
+	assert.Equal(t, sqlexec.StatementType_Select, query.Type)
+	assert.NotNil(t, query.AST)
+	assert.Equal(t, []string{"service"}, query.Tables)
+	assert.Equal(t, "mw"+t.Name(), query.DBName)
+	assert.NotNil(t, query.DB)
+	assert.Equal(t, sqlexec.CallKind_Exec, calls[1].Kind)
+	assert.Equal(t, []string{"select id,name from service where id=1", "update service set name='b' where tenant_id=? and id=1"}, server.Log())
+
+	t.Run("mock", func(t *testing.T) {
+		mock := func(next sqlexec.Handler) sqlexec.Handler {
+			return func(ctx context.Context, call *sqlexec.StatementCall) (sqlexec.StatementOutput, error) {
+				return sqlexec.StatementOutput{Out: `[{"id":"9","name":"mock"}]`, RowsAffected: 1}, nil
+			}
+		}
+		ctx := sqlexec.WithMiddlewares(ctx, mock)
+		var out []map[string]string
+		require.NoError(t, executor.ExecOrQueryContext(ctx, "select id,name from service where id=9", &out))
+		assert.Equal(t, []map[string]string{{"id": "9", "name": "mock"}}, out)
+		assert.Len(t, server.Log(), 2)
+	})
+}
+
+func TestSingleflightMiddleware(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	server := newFakeServer(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		<-release
+		return &fakeResponse{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), []byte("a")}}}, nil
+	})
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: t.Name()}, nil)
+	t.Cleanup(func() { executor.Close() })
+	query := func(wait bool) {
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var out []map[string]string
+				assert.NoError(t, executor.ExecOrQueryContext(ctx, "select id,name from service", &out))
+			}()
+		}
+		if wait {
+			time.Sleep(50 * time.Millisecond)
+			release <- struct{}{}
+		}
+		wg.Wait()
+	}
+
+	query(true)
+	assert.Len(t, server.Log(), 1)
+
+	executor.SetMiddlewares(sqlexec.LoggingMiddleware) // 去掉合并查询
+	close(release)
+	query(false)
+	assert.Len(t, server.Log(), 4)
+}
@@ -0,0 +1,116 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/sqlexec/sqlexecparser"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+// ExecOrQueryNamedContext 将带:name 占位符的sql 转换为?占位符和参数后执行,值由数据库驱动转义,不再拼接到sql中
+func ExecOrQueryNamedContext(ctx context.Context, db *sql.DB, namedSQL string, namedData map[string]any) (out string, err error) {
+	sqls, args, err := NamedToPositional(namedSQL, namedData)
+	if err != nil {
+		return "", err
+	}
+	return ExecOrQueryContext(ctx, db, sqls, args...)
+}
+
+func (e *ExecutorSQL) ExecOrQueryNamedContext(ctx context.Context, namedSQL string, namedData map[string]any, out interface{}) (err error) {
+	ctx = e.withExecutorContext(ctx)
+	sqls, args, err := NamedToPositional(namedSQL, namedData)
+	if err != nil {
+		return err
+	}
+	ctx, _, _ = withParsedStatement(ctx, sqls)
+	var str string
+	err = e.withRetry(ctx, isRetryableStatement(ctx, sqls), func(ctx context.Context) (err error) {
+		return e.withRoutedDB(ctx, sqls, true, func(ctx context.Context, db *sql.DB) (err error) {
+			str, err = ExecOrQueryContext(ctx, db, sqls, args...)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+	err = byte2Struct([]byte(str), out)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// NamedToPositional 将:name 占位符转换为?占位符,返回对应参数;切片参数展开为多个?(用于 in (:keys)),引号、反引号、注释内的内容不做替换
+func NamedToPositional(namedSQL string, namedData map[string]any) (sqls string, args []any, err error) {
+	var w strings.Builder
+	args = make([]any, 0)
+	for i := 0; i < len(namedSQL); {
+		char := namedSQL[i]
+		switch {
+		case char == ':' && i+1 < len(namedSQL) && namedSQL[i+1] == ':': // :: 转义为:
+			w.WriteByte(char)
+			i += 2
+		case char == ':' && i+1 < len(namedSQL) && isNameByte(namedSQL[i+1], true):
+			j := i + 1
+			for j < len(namedSQL) && isNameByte(namedSQL[j], false) {
+				j++
+			}
+			name := namedSQL[i+1 : j]
+			val, ok := namedData[name]
+			if !ok {
+				err = errors.Errorf("bind variable not found: :%s", name)
+				return "", nil, err
+			}
+			placeholder, vals, err := expandArg(val)
+			if err != nil {
+				err = errors.WithMessagef(err, "bind variable :%s", name)
+				return "", nil, err
+			}
+			w.WriteString(placeholder)
+			args = append(args, vals...)
+			i = j
+		default:
+			_, end := sqlexecparser.NextSegment(namedSQL, i)
+			w.WriteString(namedSQL[i:end])
+			i = end
+		}
+	}
+	return w.String(), args, nil
+}
+
+func isNameByte(char byte, first bool) bool {
+	if char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') {
+		return true
+	}
+	return !first && char >= '0' && char <= '9'
+}
+
+// expandArg 切片([]byte 除外)展开为 ?, ?, ?
+func expandArg(val any) (placeholder string, args []any, err error) {
+	rv := reflect.ValueOf(val)
+	if val == nil || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return "?", []any{val}, nil
+	}
+	if rv.Len() == 0 {
+		err = errors.Errorf("empty slice")
+		return "", nil, err
+	}
+	args = make([]any, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		args = append(args, rv.Index(i).Interface())
+	}
+	placeholder = strings.TrimSuffix(strings.Repeat("?, ", rv.Len()), ", ")
+	return placeholder, args, nil
+}
+
+// explainSQLArgs 将参数合并到sql 中,仅用于日志展示
+func explainSQLArgs(sqls string, args ...any) string {
+	if len(args) == 0 {
+		return sqls
+	}
+	return gormLogger.ExplainSQL(sqls, nil, `'`, args...)
+}
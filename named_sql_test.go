@@ -0,0 +1,65 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestNamedToPositional(t *testing.T) {
+	t.Run("in", func(t *testing.T) {
+		namedSQL := "select * from service where id=:id and name=:name and `key` in (:keys);"
+		bindVars := map[string]any{
+			"id":   1,
+			"name": "%张三\n李四",
+			"keys": []string{"a", "b"},
+		}
+		sqls, args, err := sqlexec.NamedToPositional(namedSQL, bindVars)
+		require.NoError(t, err)
+		assert.Equal(t, "select * from service where id=? and name=? and `key` in (?, ?);", sqls)
+		assert.Equal(t, []any{1, "%张三\n李四", "a", "b"}, args)
+	})
+	t.Run("quoted and comment", func(t *testing.T) {
+		namedSQL := "select ':id', `a:b`, \"x\\\":y\" -- :name\n from service where id=:id /* :id */"
+		sqls, args, err := sqlexec.NamedToPositional(namedSQL, map[string]any{"id": 2})
+		require.NoError(t, err)
+		assert.Equal(t, "select ':id', `a:b`, \"x\\\":y\" -- :name\n from service where id=? /* :id */", sqls)
+		assert.Equal(t, []any{2}, args)
+	})
+	t.Run("double dash", func(t *testing.T) { // -- 后面没有空白时不是注释
+		sqls, args, err := sqlexec.NamedToPositional("select a--:id from service", map[string]any{"id": 1})
+		require.NoError(t, err)
+		assert.Equal(t, "select a--? from service", sqls)
+		assert.Equal(t, []any{1}, args)
+	})
+	t.Run("not found", func(t *testing.T) {
+		_, _, err := sqlexec.NamedToPositional("select * from service where id=:id", map[string]any{})
+		require.Error(t, err)
+	})
+	t.Run("empty slice", func(t *testing.T) {
+		_, _, err := sqlexec.NamedToPositional("select * from service where id in (:ids)", map[string]any{"ids": []int{}})
+		require.Error(t, err)
+	})
+}
+
+func TestExecOrQueryNamedContext(t *testing.T) {
+	var gotArgs []any
+	db, server := openFakeDB(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		for _, arg := range args {
+			gotArgs = append(gotArgs, arg.Value)
+		}
+		return &fakeResponse{rowsAffected: 2}, nil
+	})
+	out, err := sqlexec.ExecOrQueryNamedContext(context.Background(), db, "update service set name=:name where id in (:ids)", map[string]any{
+		"name": "a'b",
+		"ids":  []int64{1, 2},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "2", out)
+	assert.Equal(t, []string{"update service set name=? where id in (?, ?)"}, server.Log())
+	assert.Equal(t, []any{"a'b", int64(1), int64(2)}, gotArgs)
+}
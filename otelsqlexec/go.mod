@@ -0,0 +1,63 @@
+module github.com/suifengpiao14/sqlexec/otelsqlexec
+
+go 1.21.0
+
+require (
+	github.com/pkg/errors v0.9.1
+	github.com/stretchr/testify v1.8.4
+	github.com/suifengpiao14/sqlexec v0.0.0-20261017231427-c4da0976b049
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
+
+require (
+	github.com/blastrain/vitess-sqlparser v0.0.0-20201030050434-a139afbb1aba // indirect
+	github.com/cznic/mathutil v0.0.0-20181122101859-297441e03548 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/go-ole/go-ole v1.3.0 // indirect
+	github.com/go-playground/locales v0.14.1 // indirect
+	github.com/go-playground/universal-translator v0.18.1 // indirect
+	github.com/go-playground/validator v9.31.0+incompatible // indirect
+	github.com/go-sql-driver/mysql v1.7.1 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/jfcote87/sshdb v0.5.3 // indirect
+	github.com/jmoiron/sqlx v1.3.5 // indirect
+	github.com/juju/errors v0.0.0-20170703010042-c7d06af17c68 // indirect
+	github.com/leodido/go-urn v1.2.4 // indirect
+	github.com/pingcap/errors v0.11.4 // indirect
+	github.com/pingcap/log v0.0.0-20190715063458-479153f07ebd // indirect
+	github.com/pingcap/parser v3.1.2+incompatible // indirect
+	github.com/pingcap/tidb v0.0.0-20191023085059-c9000abdc216 // indirect
+	github.com/pingcap/tipb v0.0.0-20240227061755-3670eddec8d6 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	github.com/shirou/gopsutil v3.21.11+incompatible // indirect
+	github.com/sirupsen/logrus v1.9.3 // indirect
+	github.com/spf13/cast v1.5.1 // indirect
+	github.com/suifengpiao14/ddl-executor v0.0.4 // indirect
+	github.com/suifengpiao14/funcs v0.0.18 // indirect
+	github.com/suifengpiao14/logchan/v2 v2.0.22 // indirect
+	github.com/suifengpiao14/sshmysql v0.0.6 // indirect
+	github.com/tidwall/gjson v1.17.0 // indirect
+	github.com/tidwall/match v1.1.1 // indirect
+	github.com/tidwall/pretty v1.2.0 // indirect
+	github.com/yusufpapurcu/wmi v1.2.4 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	go.uber.org/atomic v1.3.2 // indirect
+	go.uber.org/multierr v1.1.0 // indirect
+	go.uber.org/zap v1.9.1 // indirect
+	golang.org/x/crypto v0.19.0 // indirect
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/sync v0.6.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240228224816-df926f6c8641 // indirect
+	google.golang.org/grpc v1.62.0 // indirect
+	google.golang.org/protobuf v1.32.0 // indirect
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gorm.io/gorm v1.25.5 // indirect
+)
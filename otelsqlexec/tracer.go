@@ -0,0 +1,89 @@
+// Package otelsqlexec 将 sqlexec 的语句追踪适配到 OpenTelemetry。
+// 该包是独立模块,依赖已发布的 sqlexec 版本;同时修改两个模块时在仓库根目录执行
+// go work init . ./otelsqlexec 使用本地代码,go.work 不提交
+package otelsqlexec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/suifengpiao14/sqlexec"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName 创建 trace.Tracer 使用的名称
+const InstrumentationName = "github.com/suifengpiao14/sqlexec/otelsqlexec"
+
+const (
+	AttrTables       = attribute.Key("db.sql.tables")            // 语句涉及的所有表
+	AttrRowsAffected = attribute.Key("db.sqlexec.rows_affected") // 影响或返回的行数
+	AttrTxID         = attribute.Key("db.sqlexec.tx_id")
+)
+
+// Tracer 实现 sqlexec.Tracer,每条语句生成一个 client span
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+var _ sqlexec.Tracer = (*Tracer)(nil)
+
+// NewTracer provider 为nil 时使用 otel.GetTracerProvider()
+func NewTracer(provider trace.TracerProvider) (t *Tracer) {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: provider.Tracer(InstrumentationName)}
+}
+
+// StartSpan span 名称为 "操作 表名"(如 SELECT service),没有表时为操作
+func (t *Tracer) StartSpan(ctx context.Context, info sqlexec.SpanInfo) (context.Context, sqlexec.Span) {
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemKey.String(info.System),
+		semconv.DBStatement(info.Statement),
+		semconv.DBOperation(info.Operation),
+	}
+	if info.DBName != "" {
+		attrs = append(attrs, semconv.DBName(info.DBName))
+	}
+	name := strings.ToUpper(info.Operation)
+	if len(info.Tables) > 0 {
+		name += " " + info.Tables[0]
+		attrs = append(attrs, semconv.DBSQLTable(info.Tables[0]), AttrTables.StringSlice(info.Tables))
+	}
+	if info.TxID != "" {
+		attrs = append(attrs, AttrTxID.String(info.TxID))
+	}
+	if name == "" {
+		name = info.System
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, &otelSpan{span: span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s *otelSpan) End(result sqlexec.SpanResult) {
+	s.span.SetAttributes(AttrRowsAffected.Int64(result.RowsAffected))
+	if result.Err != nil {
+		s.span.RecordError(result.Err)
+		s.span.SetStatus(codes.Error, result.Err.Error())
+	}
+	s.span.End()
+}
+
+// TraceParent 从ctx 中的span 生成 W3C traceparent,作为 sqlexec.SQLCommenter 的 traceparent 标签:
+// commenter.Register(sqlexec.CommentKey_TraceParent, otelsqlexec.TraceParent)
+func TraceParent(ctx context.Context) (traceParent string) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags())
+}
@@ -0,0 +1,77 @@
+package otelsqlexec_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+	"github.com/suifengpiao14/sqlexec/otelsqlexec"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := otelsqlexec.NewTracer(provider)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	spanCtx, span := tracer.StartSpan(ctx, sqlexec.SpanInfo{
+		System:    "mysql",
+		DBName:    "curd",
+		Statement: "select id from service s join api a on a.id=s.id where s.id=?",
+		Operation: "select",
+		Tables:    []string{"service", "api"},
+		TxID:      "tx1",
+	})
+	assert.True(t, trace.SpanContextFromContext(spanCtx).IsValid())
+	span.End(sqlexec.SpanResult{RowsAffected: 2})
+	_, span = tracer.StartSpan(ctx, sqlexec.SpanInfo{System: "mysql", Statement: "delete from service", Operation: "delete", Tables: []string{"service"}})
+	span.End(sqlexec.SpanResult{Err: errors.New("denied")})
+	parent.End()
+
+	ended := recorder.Ended()
+	require.Len(t, ended, 3)
+	query := ended[0]
+	assert.Equal(t, "SELECT service", query.Name())
+	assert.Equal(t, trace.SpanKindClient, query.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), query.Parent().SpanID())
+	attrs := attribute.NewSet(query.Attributes()...)
+	for key, expected := range map[attribute.Key]attribute.Value{
+		"db.system":                  attribute.StringValue("mysql"),
+		"db.name":                    attribute.StringValue("curd"),
+		"db.statement":               attribute.StringValue("select id from service s join api a on a.id=s.id where s.id=?"),
+		"db.operation":               attribute.StringValue("select"),
+		"db.sql.table":               attribute.StringValue("service"),
+		otelsqlexec.AttrTables:       attribute.StringSliceValue([]string{"service", "api"}),
+		otelsqlexec.AttrTxID:         attribute.StringValue("tx1"),
+		otelsqlexec.AttrRowsAffected: attribute.Int64Value(2),
+	} {
+		value, ok := attrs.Value(key)
+		require.True(t, ok, key)
+		assert.Equal(t, expected, value, key)
+	}
+	assert.Equal(t, codes.Unset, query.Status().Code)
+
+	failed := ended[1]
+	assert.Equal(t, "DELETE service", failed.Name())
+	assert.Equal(t, codes.Error, failed.Status().Code)
+	assert.Equal(t, "denied", failed.Status().Description)
+	require.Len(t, failed.Events(), 1)
+	assert.Equal(t, "exception", failed.Events()[0].Name)
+}
+
+func TestTraceParent(t *testing.T) {
+	assert.Empty(t, otelsqlexec.TraceParent(context.Background()))
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+	sc := span.SpanContext()
+	assert.Equal(t, "00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-01", otelsqlexec.TraceParent(ctx))
+}
@@ -0,0 +1,265 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/sshmysql"
+)
+
+var (
+	ERROR_DB_NOT_FOUND = errors.New("db not found")
+)
+
+// HealthStatus 注册项的健康状态
+type HealthStatus struct {
+	Identity  string      `json:"identity"`
+	Connected bool        `json:"connected"` // 是否已建立连接池
+	Healthy   bool        `json:"healthy"`   // 最近一次检查是否成功
+	Error     string      `json:"error,omitempty"`
+	CheckedAt time.Time   `json:"checkedAt"` // 最近一次检查时间,未检查时为零值
+	Stats     sql.DBStats `json:"stats"`
+}
+
+type registryEntry struct {
+	executor *ExecutorSQL
+	owned    bool // executor 由 Register 创建,连接池由注册表关闭;RegisterExecutor 注册的由调用方关闭
+	status   HealthStatus
+}
+
+// Registry 按标识管理多个数据库,注册时不连接,首次使用时连接
+type Registry struct {
+	mu          sync.RWMutex
+	entries     map[string]*registryEntry
+	GracePeriod time.Duration // 热替换后延迟关闭旧连接池的时间,让已获取旧连接池的调用方执行完成
+	metrics     *MetricsCollector
+}
+
+// DefaultReplaceGracePeriod 默认热替换延迟关闭时间
+var DefaultReplaceGracePeriod = 5 * time.Second
+
+func NewRegistry() (r *Registry) {
+	return &Registry{
+		entries:     make(map[string]*registryEntry),
+		GracePeriod: DefaultReplaceGracePeriod,
+	}
+}
+
+// DefaultRegistry RegisterDB、GetDB 使用的默认注册表
+var DefaultRegistry = NewRegistry()
+
+// Register 按配置注册数据库;标识已存在且配置相同时返回已注册的 executor,
+// 配置不同时在已注册的 executor 内热替换连接池(调用方设置的策略、中间件等保留),旧连接池延迟关闭
+func (r *Registry) Register(identity string, dbConfig DBConfig, sshConfig *sshmysql.SSHConfig) (executor *ExecutorSQL, err error) {
+	err = dbConfig.Validate()
+	if err != nil {
+		return nil, errors.WithMessagef(err, "identity:%s", identity)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, ok := r.entries[identity]; ok && entry.owned {
+		if !sameConfig(entry.executor, dbConfig, sshConfig) {
+			closeOld := entry.executor.reconfigure(dbConfig, sshConfig)
+			entry.status = HealthStatus{Identity: identity}
+			time.AfterFunc(r.GracePeriod, func() {
+				_ = closeOld() // sql.DB.Close 会等待已开始的查询结束
+			})
+		}
+		return entry.executor, nil
+	}
+	executor = NewExecutorSQL(dbConfig, sshConfig)
+	r.store(identity, executor, true)
+	return executor, nil
+}
+
+// RegisterExecutor 注册已创建的 executor,标识已存在时替换;注册表不会关闭该 executor 的连接池
+func (r *Registry) RegisterExecutor(identity string, executor *ExecutorSQL) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.store(identity, executor, false)
+}
+
+// store 保存注册项,替换的旧 executor 由注册表创建时在 GracePeriod 后关闭;调用方需持有写锁
+func (r *Registry) store(identity string, executor *ExecutorSQL, owned bool) {
+	old, ok := r.entries[identity]
+	r.entries[identity] = &registryEntry{
+		executor: executor,
+		owned:    owned,
+		status:   HealthStatus{Identity: identity},
+	}
+	if r.metrics != nil {
+		r.metrics.Register(identity, executor)
+	}
+	if !ok || !old.owned || old.executor == executor {
+		return
+	}
+	time.AfterFunc(r.GracePeriod, func() {
+		_ = old.executor.Close() // sql.DB.Close 会等待已开始的查询结束
+	})
+}
+
+// sameConfig 已注册的 executor 配置是否相同
+func sameConfig(executor *ExecutorSQL, dbConfig DBConfig, sshConfig *sshmysql.SSHConfig) bool {
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+	if !reflect.DeepEqual(executor.dbConfig, dbConfig) {
+		return false
+	}
+	if executor.sshConfig == nil || sshConfig == nil {
+		return executor.sshConfig == sshConfig
+	}
+	return *executor.sshConfig == *sshConfig
+}
+
+// Get 获取已注册的 executor
+func (r *Registry) Get(identity string) (executor *ExecutorSQL, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.entries[identity]
+	if !ok {
+		err = errors.WithMessagef(ERROR_DB_NOT_FOUND, "identity:%s,use Register to set", identity)
+		return nil, err
+	}
+	return entry.executor, nil
+}
+
+// GetDB 获取已注册的连接池,未连接时建立连接
+func (r *Registry) GetDB(identity string) (db *sql.DB, err error) {
+	executor, err := r.Get(identity)
+	if err != nil {
+		return nil, err
+	}
+	return executor.GetDB()
+}
+
+// Unregister 移除注册项,由 Register 创建的同时关闭连接池
+func (r *Registry) Unregister(identity string) (err error) {
+	r.mu.Lock()
+	entry, ok := r.entries[identity]
+	delete(r.entries, identity)
+	if ok && r.metrics != nil {
+		r.metrics.Unregister(identity)
+	}
+	r.mu.Unlock()
+	if !ok || !entry.owned {
+		return nil
+	}
+	return entry.executor.Close()
+}
+
+// Range 按标识顺序遍历注册项,fn 返回false 时停止
+func (r *Registry) Range(fn func(identity string, executor *ExecutorSQL) bool) {
+	for _, identity := range r.Identities() {
+		executor, err := r.Get(identity)
+		if err != nil { // 遍历过程中被移除
+			continue
+		}
+		if !fn(identity, executor) {
+			return
+		}
+	}
+}
+
+// Identities 所有已注册的标识,按字典序排列
+func (r *Registry) Identities() (identities []string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	identities = make([]string, 0, len(r.entries))
+	for identity := range r.entries {
+		identities = append(identities, identity)
+	}
+	sort.Strings(identities)
+	return identities
+}
+
+// CloseAll 移除所有注册项并关闭由 Register 创建的连接池,返回关闭失败的错误
+func (r *Registry) CloseAll() (err error) {
+	r.mu.Lock()
+	entries := r.entries
+	r.entries = make(map[string]*registryEntry)
+	if r.metrics != nil {
+		for identity := range entries {
+			r.metrics.Unregister(identity)
+		}
+	}
+	r.mu.Unlock()
+	msgs := make([]string, 0)
+	for identity, entry := range entries {
+		if !entry.owned {
+			continue
+		}
+		if closeErr := entry.executor.Close(); closeErr != nil {
+			msgs = append(msgs, identity+":"+closeErr.Error())
+		}
+	}
+	if len(msgs) > 0 {
+		sort.Strings(msgs)
+		err = errors.Errorf("close db: %s", strings.Join(msgs, "; "))
+		return err
+	}
+	return nil
+}
+
+// CheckHealth ping 所有注册项并更新健康状态,未连接的注册项会建立连接
+func (r *Registry) CheckHealth(ctx context.Context) (statuses []HealthStatus) {
+	identities := r.Identities()
+	statuses = make([]HealthStatus, 0, len(identities))
+	for _, identity := range identities {
+		status, err := r.Check(ctx, identity)
+		if err != nil { // 检查过程中被移除
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Check ping 单个注册项并更新健康状态
+func (r *Registry) Check(ctx context.Context, identity string) (status HealthStatus, err error) {
+	executor, err := r.Get(identity)
+	if err != nil {
+		return status, err
+	}
+	status = HealthStatus{Identity: identity, CheckedAt: time.Now().Local(), Healthy: true}
+	if pingErr := executor.Ping(ctx); pingErr != nil {
+		status.Healthy = false
+		status.Error = pingErr.Error()
+	}
+	if db := executor.connectedDB(); db != nil {
+		status.Connected = true
+		status.Stats = db.Stats()
+	}
+	r.mu.Lock()
+	if entry, ok := r.entries[identity]; ok && entry.executor == executor { // 检查期间被替换时不覆盖新注册项的状态
+		entry.status = status
+	}
+	r.mu.Unlock()
+	return status, nil
+}
+
+// Status 获取注册项最近一次检查的健康状态,Connected、Stats 为当前值
+func (r *Registry) Status(identity string) (status HealthStatus, err error) {
+	r.mu.RLock()
+	entry, ok := r.entries[identity]
+	if ok {
+		status = entry.status
+	}
+	r.mu.RUnlock()
+	if !ok {
+		err = errors.WithMessagef(ERROR_DB_NOT_FOUND, "identity:%s", identity)
+		return status, err
+	}
+	status.Connected = false
+	status.Stats = sql.DBStats{}
+	if db := entry.executor.connectedDB(); db != nil {
+		status.Connected = true
+		status.Stats = db.Stats()
+	}
+	return status, nil
+}
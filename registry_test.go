@@ -0,0 +1,117 @@
+package sqlexec_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	dsnA, dsnB := t.Name()+"a", t.Name()+"b"
+	serverA := newFakeServer(t, dsnA, nil)
+	serverB := newFakeServer(t, dsnB, nil)
+	registry := sqlexec.NewRegistry()
+	registry.GracePeriod = 20 * time.Millisecond
+	t.Cleanup(func() { registry.CloseAll() })
+
+	_, err := registry.Register("main", sqlexec.DBConfig{}, nil)
+	require.Error(t, err)
+
+	executor, err := registry.Register("main", sqlexec.DBConfig{DSN: dsnA}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), serverA.Dials()) // 注册时不连接
+	same, err := registry.Register("main", sqlexec.DBConfig{DSN: dsnA}, nil)
+	require.NoError(t, err)
+	assert.Same(t, executor, same)
+	_, err = registry.GetDB("main")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), serverA.Dials())
+
+	t.Run("hot replace", func(t *testing.T) {
+		oldDB, err := executor.GetDB()
+		require.NoError(t, err)
+		replaced, err := registry.Register("main", sqlexec.DBConfig{DSN: dsnB, MaxOpen: 2}, nil)
+		require.NoError(t, err)
+		assert.Same(t, executor, replaced, "在原 executor 内替换连接池,保留调用方的设置")
+		assert.Equal(t, dsnB, executor.DBConfig().DSN)
+		require.NoError(t, oldDB.Ping()) // 延迟关闭期间旧连接池仍然可用
+		db, err := executor.GetDB()
+		require.NoError(t, err)
+		assert.NotSame(t, oldDB, db)
+		assert.Equal(t, int64(1), serverB.Dials())
+		assert.Eventually(t, func() bool {
+			return oldDB.Ping() != nil
+		}, time.Second, 5*time.Millisecond)
+		require.NoError(t, db.Ping())
+	})
+	t.Run("health", func(t *testing.T) {
+		_, err := registry.Register("backup", sqlexec.DBConfig{DSN: dsnB}, nil)
+		require.NoError(t, err)
+		executor, err := registry.Get("backup")
+		require.NoError(t, err)
+		executor.SetBackoffPolicy(sqlexec.BackoffPolicy{MaxAttempts: 1})
+		serverB.SetDown(true)
+		statuses := registry.CheckHealth(ctx)
+		require.Len(t, statuses, 2)
+		assert.Equal(t, "backup", statuses[0].Identity)
+		assert.False(t, statuses[0].Healthy)
+		assert.NotEmpty(t, statuses[0].Error)
+		serverB.SetDown(false)
+		status, err := registry.Check(ctx, "backup")
+		require.NoError(t, err)
+		assert.True(t, status.Healthy)
+		status, err = registry.Status("backup")
+		require.NoError(t, err)
+		assert.True(t, status.Healthy)
+		assert.True(t, status.Connected)
+	})
+	t.Run("range and unregister", func(t *testing.T) {
+		identities := make([]string, 0)
+		registry.Range(func(identity string, executor *sqlexec.ExecutorSQL) bool {
+			identities = append(identities, identity)
+			return true
+		})
+		assert.Equal(t, []string{"backup", "main"}, identities)
+		backup, err := registry.Get("backup")
+		require.NoError(t, err)
+		require.NoError(t, registry.Unregister("backup"))
+		_, err = registry.Get("backup")
+		require.ErrorIs(t, err, sqlexec.ERROR_DB_NOT_FOUND)
+		_, err = backup.GetDB()
+		require.ErrorIs(t, err, sqlexec.ERROR_EXECUTOR_CLOSED)
+		require.NoError(t, registry.CloseAll())
+		assert.Empty(t, registry.Identities())
+	})
+}
+
+func TestRegistryExternalDB(t *testing.T) {
+	dbA, _ := openFakeDB(t, t.Name()+"a", nil)
+	dbB, _ := openFakeDB(t, t.Name()+"b", nil)
+	registry := sqlexec.NewRegistry()
+	registry.GracePeriod = time.Millisecond
+	registry.RegisterExecutor("main", sqlexec.NewExecutorSQLWithDB(dbA))
+	registry.RegisterExecutor("main", sqlexec.NewExecutorSQLWithDB(dbB))
+	_, err := registry.Register("main", sqlexec.DBConfig{DSN: t.Name() + "a"}, nil)
+	require.NoError(t, err)
+	require.NoError(t, registry.CloseAll())
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, dbA.Ping(), "注册表不关闭调用方创建的连接池")
+	require.NoError(t, dbB.Ping())
+}
+
+func TestRegisterDB(t *testing.T) {
+	db, _ := openFakeDB(t, t.Name(), nil)
+	require.NoError(t, sqlexec.RegisterDB(t.Name(), db))
+	require.NoError(t, sqlexec.RegisterDB(t.Name(), db)) // 重复注册同一个连接池不会关闭它
+	got, err := sqlexec.GetDB(t.Name())
+	require.NoError(t, err)
+	assert.Same(t, db, got)
+	require.NoError(t, got.Ping())
+	_, err = sqlexec.GetDB("missing")
+	require.ErrorIs(t, err, sqlexec.ERROR_DB_NOT_FOUND)
+}
@@ -0,0 +1,310 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaPolicy 从库选择策略
+type ReplicaPolicy string
+
+const (
+	ReplicaPolicy_RoundRobin ReplicaPolicy = "round_robin" // 默认,轮询
+	ReplicaPolicy_LeastConn  ReplicaPolicy = "least_conn"  // 使用中连接数最少
+)
+
+// IsValid 是否为支持的从库选择策略,空值按 ReplicaPolicy_RoundRobin 处理
+func (p ReplicaPolicy) IsValid() bool {
+	switch p {
+	case "", ReplicaPolicy_RoundRobin, ReplicaPolicy_LeastConn:
+		return true
+	}
+	return false
+}
+
+// DefaultReplicaCheckInterval 默认从库健康检查间隔
+var DefaultReplicaCheckInterval = 10 * time.Second
+
+const (
+	context_Key_Primary       contextKey = "sqlexec_primary"
+	context_Key_ReadYourWrite contextKey = "sqlexec_read_your_writes"
+)
+
+// WithPrimary 本次调用的查询强制使用主库
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, context_Key_Primary, true)
+}
+
+// readYourWrites 记录同一请求内是否执行过写语句
+type readYourWrites struct {
+	written atomic.Bool
+}
+
+// WithReadYourWrites 开启读己之写:通过返回的ctx 执行过写语句后,后续查询都使用主库,通常在每个请求开始时调用
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, context_Key_ReadYourWrite, &readYourWrites{})
+}
+
+// markWritten 记录执行过写语句
+func markWritten(ctx context.Context) {
+	if rw, ok := ctx.Value(context_Key_ReadYourWrite).(*readYourWrites); ok {
+		rw.written.Store(true)
+	}
+}
+
+// forcePrimary 是否必须使用主库查询
+func forcePrimary(ctx context.Context) bool {
+	if primary, _ := ctx.Value(context_Key_Primary).(bool); primary {
+		return true
+	}
+	rw, ok := ctx.Value(context_Key_ReadYourWrite).(*readYourWrites)
+	return ok && rw.written.Load()
+}
+
+// lockingReadRegexp 加锁读必须在主库执行
+var lockingReadRegexp = regexp.MustCompile(`(?i)\bfor\s+update\b|\block\s+in\s+share\s+mode\b|\bfor\s+share\b`)
+
+// isReplicaReadable 只有不加锁的select 语句可以在从库执行
+func isReplicaReadable(sqls string) bool {
+	return firstKeyword(sqls) == "select" && !lockingReadRegexp.MatchString(sqls)
+}
+
+// replicaDB 从库连接池
+type replicaDB struct {
+	index     int
+	db        *sql.DB
+	tunnel    io.Closer
+	mu        sync.Mutex
+	healthy   bool
+	lastErr   error
+	checkedAt time.Time
+}
+
+func (r *replicaDB) isHealthy() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.db != nil && r.healthy
+}
+
+func (r *replicaDB) setHealth(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.healthy = err == nil
+	r.lastErr = err
+	r.checkedAt = time.Now().Local()
+}
+
+func (r *replicaDB) status() (status HealthStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status = HealthStatus{
+		Identity:  fmt.Sprintf("replica-%d", r.index),
+		Connected: r.db != nil,
+		Healthy:   r.db != nil && r.healthy,
+		CheckedAt: r.checkedAt,
+	}
+	if r.lastErr != nil {
+		status.Error = r.lastErr.Error()
+	}
+	if r.db != nil {
+		status.Stats = r.db.Stats()
+	}
+	return status
+}
+
+// replicaSet 一组从库及健康检查
+type replicaSet struct {
+	policy   ReplicaPolicy
+	replicas []*replicaDB
+	seq      atomic.Uint64
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// openReplicaSet 创建从库连接池(不ping),并在后台定期检查健康状态;创建失败的从库视为不健康
+func openReplicaSet(cfg DBConfig, open func(dsn string) (db *sql.DB, tunnel io.Closer, err error)) (set *replicaSet) {
+	set = &replicaSet{
+		policy:   ReplicaPolicy(cfg.ReplicaPolicy),
+		replicas: make([]*replicaDB, 0, len(cfg.Replicas)),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for i, dsn := range cfg.Replicas {
+		replica := &replicaDB{index: i, healthy: true}
+		var err error
+		replica.db, replica.tunnel, err = open(dsn)
+		if err != nil {
+			replica.setHealth(err)
+		} else {
+			replica.db.SetMaxOpenConns(cfg.MaxOpen)
+			replica.db.SetMaxIdleConns(cfg.MaxIdle)
+			replica.db.SetConnMaxIdleTime(time.Duration(cfg.MaxIdleTime) * time.Minute)
+		}
+		set.replicas = append(set.replicas, replica)
+	}
+	interval := DefaultReplicaCheckInterval
+	if cfg.ReplicaCheckInterval > 0 {
+		interval = time.Duration(cfg.ReplicaCheckInterval) * time.Second
+	}
+	go set.checkLoop(interval)
+	return set
+}
+
+func (set *replicaSet) checkLoop(interval time.Duration) {
+	defer close(set.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-set.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			set.check(ctx)
+			cancel()
+		}
+	}
+}
+
+// check ping 所有从库并更新健康状态
+func (set *replicaSet) check(ctx context.Context) (statuses []HealthStatus) {
+	statuses = make([]HealthStatus, 0, len(set.replicas))
+	for _, replica := range set.replicas {
+		if replica.db != nil {
+			replica.setHealth(replica.db.PingContext(ctx))
+		}
+		statuses = append(statuses, replica.status())
+	}
+	return statuses
+}
+
+// pick 按策略选择健康的从库,没有健康的从库时返回nil
+func (set *replicaSet) pick() (replica *replicaDB) {
+	healthy := make([]*replicaDB, 0, len(set.replicas))
+	for _, r := range set.replicas {
+		if r.isHealthy() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	if set.policy == ReplicaPolicy_LeastConn {
+		replica = healthy[0]
+		for _, r := range healthy[1:] {
+			if r.db.Stats().InUse < replica.db.Stats().InUse {
+				replica = r
+			}
+		}
+		return replica
+	}
+	n := set.seq.Add(1) - 1
+	return healthy[n%uint64(len(healthy))]
+}
+
+func (set *replicaSet) close() (err error) {
+	close(set.stop)
+	<-set.done
+	for _, replica := range set.replicas {
+		if replica.db == nil {
+			continue
+		}
+		if closeErr := closeDB(replica.db, replica.tunnel); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// routeDB 选择执行语句的连接池:不加锁的select 在没有事务、没有强制主库时使用健康的从库,其它语句使用主库并记录写操作;
+// 本executor 的事务中始终使用事务的连接池
+func (e *ExecutorSQL) routeDB(ctx context.Context, sqls string) (db *sql.DB, replica *replicaDB, err error) {
+	primary, err := e.txOrPrimaryDB(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !isReplicaReadable(sqls) {
+		if stmt, err := parseStatement(ctx, sqls); err != nil || !stmt.Type.IsQuery() || stmt.Type == StatementType_Maintenance {
+			markWritten(ctx)
+		}
+		return primary, nil, nil
+	}
+	set := e.getReplicaSet()
+	if set == nil || forcePrimary(ctx) {
+		return primary, nil, nil
+	}
+	if _, ok := TransactionFromContext(ctx, primary); ok {
+		return primary, nil, nil
+	}
+	replica = set.pick()
+	if replica == nil { // 所有从库都不健康,使用主库
+		return primary, nil, nil
+	}
+	return replica.db, replica, nil
+}
+
+// withRoutedDB 在 routeDB 选择的连接池上执行fn;从库的 driver 调用出现网络错误时标记为不健康,fallback 为true 时改用主库重试,
+// 主库的 driver 调用出现连接级别错误时切换主库
+func (e *ExecutorSQL) withRoutedDB(ctx context.Context, sqls string, fallback bool, fn func(ctx context.Context, db *sql.DB) error) (err error) {
+	db, replica, err := e.routeDB(ctx, sqls)
+	if err != nil {
+		return err
+	}
+	connErr, err := callDB(ctx, db, fn)
+	if replica == nil {
+		if connErr != nil {
+			_ = e.failover(ctx, db, connErr) // 切换失败时下次调用重新探测,返回原错误
+		}
+		return err
+	}
+	if !IsNetworkError(connErr) {
+		return err
+	}
+	replica.setHealth(connErr)
+	if !fallback {
+		return err
+	}
+	primary, err := e.txOrPrimaryDB(ctx)
+	if err != nil {
+		return err
+	}
+	connErr, err = callDB(ctx, primary, fn)
+	if connErr != nil {
+		_ = e.failover(ctx, primary, connErr)
+	}
+	return err
+}
+
+func (e *ExecutorSQL) getReplicaSet() (set *replicaSet) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.replicas
+}
+
+// CheckReplicas ping 所有从库并更新健康状态,不健康的从库不会被选择,全部不健康时查询使用主库
+func (e *ExecutorSQL) CheckReplicas(ctx context.Context) (statuses []HealthStatus) {
+	set := e.getReplicaSet()
+	if set == nil {
+		return nil
+	}
+	return set.check(ctx)
+}
+
+// ReplicaStatus 从库当前的健康状态
+func (e *ExecutorSQL) ReplicaStatus() (statuses []HealthStatus) {
+	set := e.getReplicaSet()
+	if set == nil {
+		return nil
+	}
+	statuses = make([]HealthStatus, 0, len(set.replicas))
+	for _, replica := range set.replicas {
+		statuses = append(statuses, replica.status())
+	}
+	return statuses
+}
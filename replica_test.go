@@ -0,0 +1,128 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+// openNamedServer 查询返回服务名,用于判断语句在哪个库执行
+func openNamedServer(t *testing.T, dsn string, name string) (server *fakeServer) {
+	return newFakeServer(t, dsn, func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		return &fakeResponse{
+			columns:      []string{"server", "id"},
+			rows:         [][]driver.Value{{[]byte(name), int64(1)}},
+			rowsAffected: 1,
+		}, nil
+	})
+}
+
+func TestReplicaRouting(t *testing.T) {
+	ctx := context.Background()
+	name := t.Name()
+	openNamedServer(t, name+"primary", "primary")
+	replica0 := openNamedServer(t, name+"replica0", "replica0")
+	replica1 := openNamedServer(t, name+"replica1", "replica1")
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{
+		DSN:      name + "primary",
+		Replicas: []string{name + "replica0", name + "replica1"},
+	}, nil)
+	executor.SetSingleflight(false)
+	t.Cleanup(func() { executor.Close() })
+	query := func(ctx context.Context, sqls string) string {
+		var out []map[string]string
+		require.NoError(t, executor.ExecOrQueryContext(ctx, sqls, &out))
+		require.Len(t, out, 1)
+		return out[0]["server"]
+	}
+	sqls := "select server,id from service"
+
+	t.Run("round robin", func(t *testing.T) {
+		first, second := query(ctx, sqls), query(ctx, sqls)
+		assert.ElementsMatch(t, []string{"replica0", "replica1"}, []string{first, second})
+		assert.Equal(t, first, query(ctx, sqls))
+	})
+	t.Run("primary", func(t *testing.T) {
+		assert.Equal(t, "primary", query(sqlexec.WithPrimary(ctx), sqls))
+		assert.Equal(t, "primary", query(ctx, "select server,id from service where id=1 for update"))
+		assert.Equal(t, "primary", query(ctx, "show tables"))
+		err := executor.WithTransaction(ctx, func(txCtx context.Context) error {
+			assert.Equal(t, "primary", query(txCtx, sqls))
+			return nil
+		})
+		require.NoError(t, err)
+	})
+	t.Run("read your writes", func(t *testing.T) {
+		rwCtx := sqlexec.WithReadYourWrites(ctx)
+		assert.NotEqual(t, "primary", query(rwCtx, sqls))
+		var rowsAffected int
+		require.NoError(t, executor.ExecOrQueryContext(rwCtx, "update service set name='a' where id=1", &rowsAffected))
+		assert.Equal(t, "primary", query(rwCtx, sqls))
+		assert.NotEqual(t, "primary", query(ctx, sqls)) // 其它请求不受影响
+	})
+	t.Run("generic", func(t *testing.T) {
+		type record struct {
+			Server string
+		}
+		records, err := sqlexec.Query[record](ctx, executor, sqls)
+		require.NoError(t, err)
+		assert.NotEqual(t, "primary", records[0].Server)
+		err = executor.WithTransaction(ctx, func(txCtx context.Context) error {
+			one, err := sqlexec.QueryOne[record](txCtx, executor, sqls)
+			require.NoError(t, err)
+			assert.Equal(t, "primary", one.Server)
+			return nil
+		})
+		require.NoError(t, err)
+	})
+	t.Run("fallback", func(t *testing.T) {
+		replica0.SetDown(true)
+		for i := 0; i < 3; i++ { // 宕机的从库查询失败后改用主库,并不再被选择
+			assert.NotEqual(t, "replica0", query(ctx, sqls))
+		}
+		replica1.SetDown(true)
+		statuses := executor.CheckReplicas(ctx)
+		require.Len(t, statuses, 2)
+		assert.False(t, statuses[0].Healthy)
+		assert.False(t, statuses[1].Healthy)
+		assert.Equal(t, "primary", query(ctx, sqls))
+
+		replica0.SetDown(false)
+		replica1.SetDown(false)
+		executor.CheckReplicas(ctx)
+		assert.NotEqual(t, "primary", query(ctx, sqls))
+		for _, status := range executor.ReplicaStatus() {
+			assert.True(t, status.Healthy, status.Identity)
+		}
+	})
+}
+
+func TestReplicaStatementTimeout(t *testing.T) { // 语句超时不是从库故障,不标记不健康,也不改用主库重试
+	ctx := context.Background()
+	name := t.Name()
+	primary := openNamedServer(t, name+"primary", "primary")
+	newFakeServer(t, name+"replica", func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		time.Sleep(20 * time.Millisecond)
+		return nil, driver.ErrBadConn // 超时后连接被驱动关闭
+	})
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: name + "primary", Replicas: []string{name + "replica"}}, nil)
+	t.Cleanup(func() { executor.Close() })
+	var out []map[string]string
+	err := executor.ExecOrQueryContext(sqlexec.WithStatementTimeout(ctx, 5*time.Millisecond), "select server,id from service", &out)
+	require.Error(t, err)
+	assert.Empty(t, primary.Log())
+	for _, status := range executor.ReplicaStatus() {
+		assert.True(t, status.Healthy, status.Identity)
+	}
+}
+
+func TestReplicaPolicyValidate(t *testing.T) {
+	err := sqlexec.DBConfig{DSN: "primary", Replicas: []string{""}, ReplicaPolicy: "random"}.Validate()
+	require.ErrorContains(t, err, "DBConfig.Replicas[0]")
+	require.ErrorContains(t, err, "DBConfig.ReplicaPolicy")
+}
@@ -0,0 +1,153 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// ResultMode 查询结果的值类型
+type ResultMode string
+
+const (
+	ResultMode_String ResultMode = "string" // 默认,所有值转为字符串,NULL 转为空字符串
+	ResultMode_Typed  ResultMode = "typed"  // 按列类型输出json 数字、布尔、null、RFC3339 时间、base64 二进制、内嵌json
+)
+
+const (
+	context_Key_ResultMode contextKey = "sqlexec_result_mode"
+)
+
+// WithResultMode 设置本次调用的结果类型,优先级高于 ExecutorSQL.SetResultMode
+func WithResultMode(ctx context.Context, mode ResultMode) context.Context {
+	return context.WithValue(ctx, context_Key_ResultMode, mode)
+}
+
+func resultModeFromContext(ctx context.Context) (mode ResultMode, ok bool) {
+	mode, ok = ctx.Value(context_Key_ResultMode).(ResultMode)
+	return mode, ok
+}
+
+func getResultMode(ctx context.Context) (mode ResultMode) {
+	mode, ok := resultModeFromContext(ctx)
+	if !ok || mode == "" {
+		return ResultMode_String
+	}
+	return mode
+}
+
+// rowScanner 按结果集的列类型扫描行数据
+type rowScanner struct {
+	mode        ResultMode
+	columns     []string
+	columnTypes []*sql.ColumnType
+}
+
+func newRowScanner(rows *sql.Rows, mode ResultMode) (scanner *rowScanner, err error) {
+	scanner = &rowScanner{mode: mode}
+	scanner.columns, err = rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	scanner.columnTypes, err = rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	return scanner, nil
+}
+
+func (s *rowScanner) scan(rows *sql.Rows) (record map[string]any, err error) {
+	values := make([]any, len(s.columns))
+	dest := make([]any, len(s.columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	err = rows.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+	record = make(map[string]any, len(s.columns))
+	for i, column := range s.columns {
+		if s.mode == ResultMode_Typed {
+			record[column] = convertTypedValue(s.columnTypes[i].DatabaseTypeName(), values[i])
+			continue
+		}
+		record[column] = cast.ToString(values[i])
+	}
+	return record, nil
+}
+
+// convertTypedValue 根据数据库列类型转换为可直接json 序列化的值
+func convertTypedValue(dbType string, val any) any {
+	if val == nil {
+		return nil
+	}
+	b, isBytes := val.([]byte)
+	dbType = strings.TrimPrefix(strings.ToUpper(dbType), "UNSIGNED ")
+	switch dbType {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "YEAR", "DECIMAL", "FLOAT", "DOUBLE":
+		if isBytes {
+			return json.Number(b) // 保持精度,decimal、bigint unsigned 不丢失
+		}
+		return val
+	case "BIT":
+		if isBytes {
+			if len(b) == 1 && b[0] <= 1 { // bit(1) 作为布尔值
+				return b[0] == 1
+			}
+			var n uint64
+			for _, c := range b {
+				n = n<<8 | uint64(c)
+			}
+			return n
+		}
+		return val
+	case "DATETIME", "TIMESTAMP":
+		switch v := val.(type) {
+		case time.Time:
+			return v.Format(time.RFC3339)
+		case []byte:
+			t, err := time.ParseInLocation("2006-01-02 15:04:05.999999", string(v), time.Local)
+			if err != nil { // 0000-00-00 00:00:00 等无法解析的值原样返回
+				return string(v)
+			}
+			return t.Format(time.RFC3339)
+		}
+		return val
+	case "DATE":
+		if t, ok := val.(time.Time); ok {
+			return t.Format("2006-01-02")
+		}
+	case "JSON":
+		if isBytes && json.Valid(b) {
+			return json.RawMessage(b)
+		}
+	case "BINARY", "VARBINARY", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "GEOMETRY":
+		if isBytes {
+			cp := make([]byte, len(b))
+			copy(cp, b)
+			return cp // json 序列化为base64
+		}
+		return val
+	}
+	if isBytes {
+		return string(b)
+	}
+	return val
+}
+
+// singleValue 只有一个值时直接返回值本身,字符串模式返回原始字符串,类型模式返回json 编码的值
+func singleValue(mode ResultMode, val any) (out string, err error) {
+	if mode != ResultMode_Typed {
+		return cast.ToString(val), nil
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,64 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestResultMode(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	db, _ := openFakeDB(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		if hasPrefixFold(query, "select count") {
+			return &fakeResponse{columns: []string{"cnt"}, types: []string{"BIGINT"}, rows: [][]driver.Value{{[]byte("3")}}}, nil
+		}
+		return &fakeResponse{
+			columns: []string{"id", "price", "deleted", "name", "remark", "extra", "data", "created_at"},
+			types:   []string{"UNSIGNED BIGINT", "DECIMAL", "BIT", "VARCHAR", "VARCHAR", "JSON", "BLOB", "DATETIME"},
+			rows: [][]driver.Value{
+				{[]byte("18446744073709551615"), []byte("12.50"), []byte{1}, []byte("a"), nil, []byte(`{"k":[1,2]}`), []byte{0xff, 0x00}, createdAt},
+			},
+		}, nil
+	})
+	ctx := context.Background()
+	sql := "select * from service where id=1"
+	t.Run("string", func(t *testing.T) {
+		out, err := sqlexec.QueryContext(ctx, db, sql)
+		require.NoError(t, err)
+		assert.Contains(t, out, `"id":"18446744073709551615"`)
+		assert.Contains(t, out, `"remark":""`)
+		assert.Contains(t, out, `"price":"12.50"`)
+	})
+	t.Run("typed", func(t *testing.T) {
+		out, err := sqlexec.QueryContext(sqlexec.WithResultMode(ctx, sqlexec.ResultMode_Typed), db, sql)
+		require.NoError(t, err)
+		assert.JSONEq(t, `[{"id":18446744073709551615,"price":12.50,"deleted":true,"name":"a","remark":null,"extra":{"k":[1,2]},"data":"/wA=","created_at":"2024-01-02T03:04:05Z"}]`, out)
+	})
+	t.Run("typed single value", func(t *testing.T) {
+		out, err := sqlexec.QueryContext(sqlexec.WithResultMode(ctx, sqlexec.ResultMode_Typed), db, "select count(*) as cnt from service")
+		require.NoError(t, err)
+		assert.Equal(t, "3", out)
+	})
+	t.Run("executor setting", func(t *testing.T) {
+		executor := sqlexec.NewExecutorSQLWithDB(db)
+		done := make(chan struct{})
+		go func() { // 执行期间修改设置
+			defer close(done)
+			for i := 0; i < 20; i++ {
+				executor.SetResultMode(sqlexec.ResultMode_Typed)
+			}
+		}()
+		var out []map[string]any
+		for i := 0; i < 20; i++ {
+			require.NoError(t, executor.ExecOrQueryContext(ctx, sql, &out))
+		}
+		<-done
+		require.NoError(t, executor.ExecOrQueryContext(ctx, sql, &out))
+		assert.Equal(t, true, out[0]["deleted"])
+	})
+}
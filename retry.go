@@ -0,0 +1,146 @@
+package sqlexec
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryRule 一类错误的重试规则
+type RetryRule struct {
+	Kind        error `json:"-"`           // 错误分类,如 ErrDeadlock,通过 errors.Is 匹配
+	MaxAttempts int   `json:"maxAttempts"` // 该类错误最多执行次数(含第一次),0 使用 RetryPolicy.MaxAttempts
+}
+
+// RetryPolicy 语句及事务失败时的自动重试策略:读语句和整个事务闭包按规则重试,单条写语句只有通过 WithIdempotent 标记为幂等时才重试;
+// 事务内的单条语句不重试,由外层事务整体重试,且事务只在 COMMIT 之前发生死锁、锁等待超时时重试
+type RetryPolicy struct {
+	BackoffPolicy             // 退避间隔及默认最多执行次数;Retryable 不为nil 时忽略 Rules
+	Rules         []RetryRule `json:"rules"`
+}
+
+// DefaultRetryPolicy 默认重试策略:死锁、锁等待超时、连接错误最多执行3次,间隔50ms、100ms,上下浮动20%
+var DefaultRetryPolicy = RetryPolicy{
+	BackoffPolicy: BackoffPolicy{
+		MaxAttempts:     3,
+		InitialInterval: 50 * time.Millisecond,
+		MaxInterval:     time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+	},
+	Rules: []RetryRule{
+		{Kind: ErrDeadlock},
+		{Kind: ErrLockWaitTimeout},
+		{Kind: ErrConnection},
+	},
+}
+
+// Do 执行fn,错误符合规则时按退避间隔重试,ctx 取消时立即返回
+func (p RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	return p.do(ctx, fn, p.shouldRetry)
+}
+
+// shouldRetry 已执行 attempt 次后err 是否可以重试,err 未分类时先按 ClassifyError 分类
+func (p RetryPolicy) shouldRetry(err error, attempt int) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if p.Retryable != nil {
+		return attempt < p.MaxAttempts && p.Retryable(err)
+	}
+	err = ClassifyError(err, "", "")
+	for _, rule := range p.Rules {
+		if rule.Kind == nil || !errors.Is(err, rule.Kind) {
+			continue
+		}
+		maxAttempts := rule.MaxAttempts
+		if maxAttempts == 0 {
+			maxAttempts = p.MaxAttempts
+		}
+		return attempt < maxAttempts
+	}
+	return false
+}
+
+const (
+	context_Key_Attempt    contextKey = "sqlexec_attempt"
+	context_Key_Idempotent contextKey = "sqlexec_idempotent"
+)
+
+// withAttempt 记录当前是第几次执行,用于 LogInfoEXECSQL.Attempt
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, context_Key_Attempt, attempt)
+}
+
+func attemptFromContext(ctx context.Context) (attempt int) {
+	attempt, _ = ctx.Value(context_Key_Attempt).(int)
+	return attempt
+}
+
+// WithIdempotent 标记本次调用的写语句为幂等,失败时可按 RetryPolicy 重试
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, context_Key_Idempotent, true)
+}
+
+func idempotentFromContext(ctx context.Context) bool {
+	idempotent, _ := ctx.Value(context_Key_Idempotent).(bool)
+	return idempotent
+}
+
+// SetRetryPolicy 设置语句及事务失败时的重试策略,默认不重试;可使用 DefaultRetryPolicy
+func (e *ExecutorSQL) SetRetryPolicy(policy RetryPolicy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.retryPolicy = &policy
+}
+
+func (e *ExecutorSQL) getRetryPolicy() (policy *RetryPolicy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.retryPolicy
+}
+
+// withRetry 按重试策略执行fn;未设置策略、已在事务中或 retryable 为false 时只执行一次
+func (e *ExecutorSQL) withRetry(ctx context.Context, retryable bool, fn func(ctx context.Context) error) (err error) {
+	return e.withRetryIf(ctx, retryable, nil, fn)
+}
+
+// withRetryIf 同 withRetry,canRetry 不为nil 时错误还需满足canRetry 才重试
+func (e *ExecutorSQL) withRetryIf(ctx context.Context, retryable bool, canRetry func(err error) bool, fn func(ctx context.Context) error) (err error) {
+	policy := e.getRetryPolicy()
+	if policy == nil || !retryable || ctx.Value(context_Key_Transaction) != nil {
+		return fn(ctx)
+	}
+	if canRetry == nil {
+		return policy.Do(ctx, fn)
+	}
+	return policy.do(ctx, fn, func(err error, attempt int) bool {
+		return canRetry(err) && policy.shouldRetry(err, attempt)
+	})
+}
+
+// isRetryableTransaction 事务整体重试只针对 COMMIT 之前发生的死锁、锁等待超时;COMMIT 出错(如网络错误)时事务可能已经提交,不重试
+func isRetryableTransaction(err error, commitSent bool) bool {
+	if commitSent {
+		return false
+	}
+	err = ClassifyError(err, "", "")
+	return errors.Is(err, ErrDeadlock) || errors.Is(err, ErrLockWaitTimeout)
+}
+
+// isRetryableStatement 读语句可以重试,写语句需要标记为幂等
+func isRetryableStatement(ctx context.Context, sqls string) bool {
+	if idempotentFromContext(ctx) {
+		return true
+	}
+	stmt, err := parseStatement(ctx, sqls)
+	if err != nil {
+		return false
+	}
+	switch stmt.Type {
+	case StatementType_Select, StatementType_Show:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestExecutorSQLRetry(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	failures := map[string]int{} // 语句剩余的失败次数
+	server := newFakeServer(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for prefix, n := range failures {
+			if strings.HasPrefix(query, prefix) && n > 0 {
+				failures[prefix] = n - 1
+				return nil, &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock; try restarting transaction"}
+			}
+		}
+		return &fakeResponse{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), []byte("a")}}, rowsAffected: 1}, nil
+	})
+	fail := func(prefix string, n int) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures[prefix] = n
+	}
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: t.Name()}, nil)
+	policy := sqlexec.DefaultRetryPolicy
+	policy.InitialInterval = time.Millisecond
+	executor.SetRetryPolicy(policy)
+	t.Cleanup(func() { executor.Close() })
+	count := func(sqls string) (n int) {
+		for _, query := range server.Log() {
+			if query == sqls {
+				n++
+			}
+		}
+		return n
+	}
+	var out []map[string]string
+	var rowsAffected int
+
+	fail("select", 2)
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "select id,name from service", &out))
+	assert.Equal(t, 3, count("select id,name from service"))
+
+	fail("select", 3) // 超过最多执行次数
+	err := executor.ExecOrQueryContext(ctx, "select id,name from service where id=2", &out)
+	assert.ErrorIs(t, err, sqlexec.ErrDeadlock)
+	assert.Equal(t, 3, count("select id,name from service where id=2"))
+
+	fail("update", 1) // 非幂等写语句不重试
+	err = executor.ExecOrQueryContext(ctx, "update service set name='a' where id=1", &rowsAffected)
+	assert.ErrorIs(t, err, sqlexec.ErrDeadlock)
+	assert.Equal(t, 1, count("update service set name='a' where id=1"))
+
+	fail("update", 1)
+	require.NoError(t, executor.ExecOrQueryContext(sqlexec.WithIdempotent(ctx), "update service set name='b' where id=1", &rowsAffected))
+	assert.Equal(t, 2, count("update service set name='b' where id=1"))
+
+	fail("select", 1) // 泛型查询同样重试
+	records, err := sqlexec.Query[struct{ Name string }](ctx, executor, "select id,name from service where id=3")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "a", records[0].Name)
+	assert.Equal(t, 2, count("select id,name from service where id=3"))
+
+	fail("update", 1) // 事务整体重试,事务内语句不单独重试
+	calls := 0
+	err = executor.WithTransaction(ctx, func(ctx context.Context) error {
+		calls++
+		var rowsAffected int
+		return executor.ExecOrQueryContext(ctx, "update service set name='c' where id=1", &rowsAffected)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 2, count("update service set name='c' where id=1"))
+
+	fail("COMMIT", 1) // COMMIT 出错时结果未知,不重试
+	calls = 0
+	err = executor.WithTransaction(ctx, func(ctx context.Context) error {
+		calls++
+		var rowsAffected int
+		return executor.ExecOrQueryContext(ctx, "update service set name='d' where id=1", &rowsAffected)
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+
+	t.Run("rules", func(t *testing.T) {
+		policy := sqlexec.RetryPolicy{
+			BackoffPolicy: sqlexec.BackoffPolicy{MaxAttempts: 2},
+			Rules:         []sqlexec.RetryRule{{Kind: sqlexec.ErrDeadlock, MaxAttempts: 4}},
+		}
+		attempts := []int{}
+		err := policy.Do(ctx, func(ctx context.Context) error {
+			attempts = append(attempts, len(attempts)+1)
+			return &mysql.MySQLError{Number: 1213}
+		})
+		assert.Error(t, err) // Do 按分类判断是否重试,返回原错误
+		assert.Equal(t, []int{1, 2, 3, 4}, attempts)
+
+		calls := 0
+		err = policy.Do(ctx, func(ctx context.Context) error {
+			calls++
+			return &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"}
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+}
@@ -0,0 +1,132 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/sqlexec/sqlexecparser"
+)
+
+// ScriptOptions 脚本执行选项
+type ScriptOptions struct {
+	Transaction     bool `json:"transaction"`     // 所有语句在同一个事务中执行,任一语句出错则停止并回滚
+	ContinueOnError bool `json:"continueOnError"` // 非事务模式下,语句出错后继续执行后续语句
+}
+
+// StatementResult 脚本中单条语句的执行结果
+type StatementResult struct {
+	SQL          string        `json:"sql"`
+	Type         StatementType `json:"type"`
+	Rows         string        `json:"rows,omitempty"` // 查询语句的结果,格式同 QueryContext
+	RowsAffected int64         `json:"rowsAffected"`
+	LastInsertId int64         `json:"lastInsertId"`
+	Insert       *InsertResult `json:"insert,omitempty"` // insert、replace 语句的插入结果
+	Duration     time.Duration `json:"duration"`
+	Err          error         `json:"-"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// ExecScript 拆分脚本(支持引号、注释、DELIMITER)后按顺序逐条执行,返回每条语句的结果;err 为第一条出错语句的错误。
+// 整个脚本使用同一个连接,set、use 等会话语句对后续语句生效;执行过 use 的连接在结束后关闭,不放回连接池
+func ExecScript(ctx context.Context, db *sql.DB, script string, options ScriptOptions) (results []StatementResult, err error) {
+	statements := sqlexecparser.SplitStatements(script)
+	results = make([]StatementResult, 0, len(statements))
+	ctx, release, err := pinConn(ctx, db)
+	if err != nil {
+		return results, err
+	}
+	defer release()
+	run := func(ctx context.Context) (err error) {
+		for _, sqls := range statements {
+			result := execScriptStatement(ctx, db, sqls)
+			results = append(results, result)
+			if result.Err == nil {
+				continue
+			}
+			if err == nil {
+				err = errors.WithMessagef(result.Err, "statement %d", len(results))
+			}
+			if options.Transaction || !options.ContinueOnError {
+				return err
+			}
+		}
+		return err
+	}
+	if options.Transaction {
+		err = WithTransaction(ctx, db, run)
+		return results, err
+	}
+	err = run(ctx)
+	return results, err
+}
+
+func (e *ExecutorSQL) ExecScript(ctx context.Context, script string, options ScriptOptions) (results []StatementResult, err error) {
+	ctx = e.withExecutorContext(ctx)
+	db, err := e.txOrPrimaryDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	markWritten(ctx)
+	connErr, err := callDB(ctx, db, func(ctx context.Context, db *sql.DB) (err error) {
+		results, err = ExecScript(ctx, db, script, options)
+		return err
+	})
+	if connErr != nil {
+		_ = e.failover(ctx, db, connErr)
+	}
+	return results, err
+}
+
+func execScriptStatement(ctx context.Context, db *sql.DB, sqls string) (result StatementResult) {
+	result.SQL = sqls
+	beginAt := time.Now()
+	defer func() {
+		result.Duration = time.Since(beginAt)
+		if result.Err != nil {
+			result.Error = result.Err.Error()
+		}
+	}()
+	if firstKeyword(sqls) == "use" {
+		result.Err = execScriptUse(ctx, db, sqls)
+		return result
+	}
+	ctx, stmt, err := withParsedStatement(ctx, sqls)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Type = stmt.Type
+	if stmt.Type.IsQuery() {
+		result.Rows, result.Err = QueryContext(ctx, db, sqls)
+		return result
+	}
+	if stmt.Type == StatementType_Insert || stmt.Type == StatementType_Replace {
+		result.Insert, result.Err = insertContext(ctx, db, stmt)
+		if result.Err == nil {
+			result.LastInsertId, result.RowsAffected = result.Insert.FirstId, result.Insert.RowsAffected
+		}
+		return result
+	}
+	result.LastInsertId, result.RowsAffected, result.Err = ExecContext(ctx, db, sqls)
+	return result
+}
+
+// execScriptUse 在脚本固定的连接(或其上的事务)中执行 use,并标记连接在脚本结束后关闭;调用方传入的事务中不支持
+func execScriptUse(ctx context.Context, db *sql.DB, sqls string) (err error) {
+	pinned, ok := pinnedConnFromContext(ctx, db)
+	if !ok {
+		err = errors.WithMessagef(ERROR_UNSUPPORTED_STATEMENT, "use in caller transaction,sql:%s", sqls)
+		return err
+	}
+	executor, txID := getSQLExecutor(ctx, db)
+	logInfo := &LogInfoEXECSQL{SQL: sqls, TxID: txID, BeginAt: time.Now().Local()}
+	pinned.dirty = true
+	_, err = executor.ExecContext(ctx, sqls)
+	logInfo.EndAt = time.Now().Local()
+	logInfo.Err = err
+	sendLogInfoEXECSQL(ctx, logInfo)
+	recordConnFailure(ctx, db, err)
+	return err
+}
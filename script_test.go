@@ -0,0 +1,83 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestExecScript(t *testing.T) {
+	handler := func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		switch {
+		case hasPrefixFold(query, "insert"):
+			return &fakeResponse{lastInsertId: 5, rowsAffected: 2}, nil
+		case strings.Contains(query, "select"):
+			return &fakeResponse{columns: []string{"id"}, rows: [][]driver.Value{{int64(5)}, {int64(6)}}}, nil
+		case hasPrefixFold(query, "update missing"):
+			return nil, errors.New("table not exists")
+		}
+		return &fakeResponse{rowsAffected: 1}, nil
+	}
+	script := `
+	insert into service (name) values('a;'),('b');
+	-- 查询
+	select id from service;
+	update missing set name='c';
+	delete from service where id=5;
+	`
+	ctx := context.Background()
+	t.Run("stop on error", func(t *testing.T) {
+		db, server := openFakeDB(t, t.Name(), handler)
+		results, err := sqlexec.ExecScript(ctx, db, script, sqlexec.ScriptOptions{})
+		require.Error(t, err)
+		require.Len(t, results, 3)
+		assert.Equal(t, sqlexec.StatementType_Insert, results[0].Type)
+		assert.Equal(t, []int64{5, 6}, results[0].Insert.Ids)
+		assert.Equal(t, `[{"id":"5"},{"id":"6"}]`, results[1].Rows)
+		assert.Equal(t, "table not exists", results[2].Error)
+		assert.Len(t, server.Log(), 4) // 含 SELECT @@auto_increment_increment
+	})
+	t.Run("continue on error", func(t *testing.T) {
+		db, _ := openFakeDB(t, t.Name(), handler)
+		results, err := sqlexec.ExecScript(ctx, db, script, sqlexec.ScriptOptions{ContinueOnError: true})
+		require.Error(t, err)
+		require.Len(t, results, 4)
+		assert.Equal(t, int64(1), results[3].RowsAffected)
+	})
+	t.Run("transaction", func(t *testing.T) {
+		db, server := openFakeDB(t, t.Name(), handler)
+		_, err := sqlexec.ExecScript(ctx, db, script, sqlexec.ScriptOptions{Transaction: true, ContinueOnError: true})
+		require.Error(t, err)
+		log := server.Log()
+		assert.Equal(t, "BEGIN", log[0])
+		assert.Equal(t, "ROLLBACK", log[len(log)-1])
+		assert.Len(t, log, 6)
+	})
+	t.Run("pinned conn", func(t *testing.T) {
+		db, server := openFakeDB(t, t.Name(), handler)
+		db.SetMaxIdleConns(0) // 不固定连接时每条语句都会新建连接
+		_, err := sqlexec.ExecScript(ctx, db, "set names utf8mb4;select id from service;delete from service where id=5;", sqlexec.ScriptOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), server.Dials())
+	})
+	t.Run("use", func(t *testing.T) {
+		db, server := openFakeDB(t, t.Name(), handler)
+		results, err := sqlexec.ExecScript(ctx, db, "use `curd`;delete from service where id=5;", sqlexec.ScriptOptions{Transaction: true})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, []string{"BEGIN", "use `curd`", "delete from service where id=5", "COMMIT"}, server.Log())
+		assert.Equal(t, 0, db.Stats().OpenConnections, "执行过 use 的连接不放回连接池")
+
+		err = sqlexec.WithTransaction(ctx, db, func(ctx context.Context) error {
+			_, err := sqlexec.ExecScript(ctx, db, "use `curd`;", sqlexec.ScriptOptions{})
+			return err
+		})
+		require.ErrorIs(t, err, sqlexec.ERROR_UNSUPPORTED_STATEMENT)
+	})
+}
@@ -0,0 +1,92 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	context_Key_Singleflight contextKey = "sqlexec_singleflight"
+)
+
+var execOrQueryContextSingleflight = new(singleflight.Group)
+
+// WithSingleflight 设置本次调用是否合并相同的并发查询,优先级高于 ExecutorSQL.SetSingleflight;
+// 默认开启,事务内默认关闭(显式开启时仅合并同一事务内的查询),包含 NOW()、RAND() 等非确定性函数的查询始终关闭
+func WithSingleflight(ctx context.Context, enable bool) context.Context {
+	return context.WithValue(ctx, context_Key_Singleflight, enable)
+}
+
+func singleflightFromContext(ctx context.Context) (enable bool, ok bool) {
+	enable, ok = ctx.Value(context_Key_Singleflight).(bool)
+	return enable, ok
+}
+
+// nonDeterministicRegexp 每次执行结果可能不同的函数及加锁读,这类查询不能共享结果
+var nonDeterministicRegexp = regexp.MustCompile(`(?i)\b(now|sysdate|rand|uuid|uuid_short|curdate|curtime|current_date|current_time|current_timestamp|localtime|localtimestamp|utc_date|utc_time|utc_timestamp|unix_timestamp|last_insert_id|found_rows|row_count|connection_id|sleep|get_lock|release_lock|is_free_lock|is_used_lock)\s*\(|\bcurrent_(date|time|timestamp)\b|\bfor\s+update\b|\block\s+in\s+share\s+mode\b|\bfor\s+share\b`)
+
+// IsNonDeterministic sql 是否包含非确定性函数或加锁读
+func IsNonDeterministic(sqls string) bool {
+	return nonDeterministicRegexp.MatchString(sqls)
+}
+
+// useSingleflight 判断本次查询是否合并
+func useSingleflight(ctx context.Context, txID string, sqls string) bool {
+	enable, ok := singleflightFromContext(ctx)
+	if !ok {
+		enable = txID == "" // 事务内需要读取本事务的修改，默认不和其它查询共享结果
+	}
+	if !enable {
+		return false
+	}
+	return !IsNonDeterministic(sqls)
+}
+
+// singleflightKey 合并查询的key,包含db、事务、结果类型、语句检查策略、原始sql 及参数的精确编码,
+// 不同库、不同事务、不同检查策略、不同参数的相同sql 不共享结果
+func singleflightKey(db *sql.DB, txID string, mode ResultMode, policy *GuardrailPolicy, sqls string, args ...any) string {
+	var w strings.Builder
+	fmt.Fprintf(&w, "%p|%s|%s|", db, txID, mode)
+	if policy != nil { // 语句检查在合并的调用内按执行者的策略进行
+		fmt.Fprintf(&w, "%+v", *policy)
+	}
+	fmt.Fprintf(&w, "|%d:%s", len(sqls), sqls)
+	for _, arg := range args {
+		var v string
+		switch arg := arg.(type) {
+		case []byte:
+			v = string(arg)
+		case string:
+			v = arg
+		default:
+			v = fmt.Sprintf("%#v", arg)
+		}
+		fmt.Fprintf(&w, "|%T:%d:%s", arg, len(v), v) // 带长度,参数内容包含分隔符时也不会冲突
+	}
+	return w.String()
+}
+
+// doSingleflight 合并相同key 的并发调用;共享的调用使用脱离调用方取消信号的ctx 执行,
+// 单个调用方取消只会让该调用方提前返回,不影响其它等待者
+func doSingleflight(ctx context.Context, key string, fn func(ctx context.Context) (any, error)) (v any, err error) {
+	detached := context.WithoutCancel(ctx)
+	executed := false
+	ch := execOrQueryContextSingleflight.DoChan(key, func() (any, error) {
+		executed = true // 结果写入ch 前完成赋值,读取ch 后可以安全访问
+		return fn(detached)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if !executed {
+			addSingleflightHit(ctx)
+		}
+		return res.Val, res.Err
+	}
+}
@@ -0,0 +1,199 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+// openBlockingDB 查询阻塞到release 关闭,用于构造并发查询
+func openBlockingDB(t *testing.T, dsn string, name string) (db *sql.DB, server *fakeServer, release chan struct{}) {
+	release = make(chan struct{})
+	db, server = openFakeDB(t, dsn, func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		<-release
+		return &fakeResponse{columns: []string{"name"}, rows: [][]driver.Value{{[]byte(name)}}}, nil
+	})
+	return db, server, release
+}
+
+// queryConcurrently 并发执行n 次相同查询
+func queryConcurrently(ctx context.Context, db *sql.DB, sqls string, n int, release chan struct{}) (outs []string, errs []error) {
+	outs, errs = make([]string, n), make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outs[i], errs[i] = sqlexec.QueryContext(ctx, db, sqls)
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond) // 等待所有查询进入等待
+	close(release)
+	wg.Wait()
+	return outs, errs
+}
+
+func TestQueryContextSingleflight(t *testing.T) {
+	ctx := context.Background()
+	t.Run("dedup", func(t *testing.T) {
+		db, server, release := openBlockingDB(t, t.Name(), "a")
+		outs, errs := queryConcurrently(ctx, db, "select name from service where id=1", 5, release)
+		for i := range outs {
+			require.NoError(t, errs[i])
+			assert.Equal(t, "a", outs[i])
+		}
+		assert.Len(t, server.Log(), 1)
+	})
+	t.Run("disabled", func(t *testing.T) {
+		db, server, release := openBlockingDB(t, t.Name(), "a")
+		_, errs := queryConcurrently(sqlexec.WithSingleflight(ctx, false), db, "select name from service where id=1", 3, release)
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+		assert.Len(t, server.Log(), 3)
+	})
+	t.Run("non deterministic", func(t *testing.T) {
+		db, server, release := openBlockingDB(t, t.Name(), "a")
+		_, errs := queryConcurrently(ctx, db, "select now()", 3, release)
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+		assert.Len(t, server.Log(), 3)
+	})
+	t.Run("keyed by db", func(t *testing.T) {
+		dbA, _, releaseA := openBlockingDB(t, t.Name()+"a", "a")
+		dbB, _, releaseB := openBlockingDB(t, t.Name()+"b", "b")
+		sqls := "select name from service where id=1"
+		var outA, outB string
+		var errA, errB error
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() { defer wg.Done(); outA, errA = sqlexec.QueryContext(ctx, dbA, sqls) }()
+		go func() { defer wg.Done(); outB, errB = sqlexec.QueryContext(ctx, dbB, sqls) }()
+		time.Sleep(50 * time.Millisecond)
+		close(releaseA)
+		close(releaseB)
+		wg.Wait()
+		require.NoError(t, errA)
+		require.NoError(t, errB)
+		assert.Equal(t, "a", outA)
+		assert.Equal(t, "b", outB)
+	})
+	t.Run("keyed by args", func(t *testing.T) {
+		release := make(chan struct{})
+		db, server := openFakeDB(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+			<-release
+			return &fakeResponse{columns: []string{"name"}, rows: [][]driver.Value{{[]byte{args[0].Value.([]byte)[0] + '0'}}}}, nil
+		})
+		sqls := "select name from service where code=?"
+		outs, errs := make([]string, 2), make([]error, 2)
+		var wg sync.WaitGroup
+		for i, arg := range [][]byte{{1, 0xff}, {2, 0xff}} { // 日志中两者都渲染为不可见字符,key 不能冲突
+			wg.Add(1)
+			go func(i int, arg []byte) {
+				defer wg.Done()
+				outs[i], errs[i] = sqlexec.QueryContext(ctx, db, sqls, arg)
+			}(i, arg)
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		require.NoError(t, errs[0])
+		require.NoError(t, errs[1])
+		assert.Equal(t, []string{"1", "2"}, outs)
+		assert.Len(t, server.Log(), 2)
+	})
+	t.Run("keyed by guardrails", func(t *testing.T) {
+		db, server, release := openBlockingDB(t, t.Name(), "a")
+		sqls := "select name from service"
+		policies := []*sqlexec.GuardrailPolicy{nil, {DefaultLimit: 1}, {RequireLimit: true}}
+		outs, errs := make([]string, len(policies)), make([]error, len(policies))
+		var wg sync.WaitGroup
+		for i, policy := range policies {
+			wg.Add(1)
+			go func(i int, policy *sqlexec.GuardrailPolicy) {
+				defer wg.Done()
+				outs[i], errs[i] = sqlexec.QueryContext(sqlexec.WithGuardrails(ctx, policy), db, sqls)
+			}(i, policy)
+			time.Sleep(20 * time.Millisecond) // 无检查策略的查询先执行,其它策略的调用不能共享其结果
+		}
+		close(release)
+		wg.Wait()
+		require.NoError(t, errs[0])
+		require.NoError(t, errs[1])
+		require.ErrorIs(t, errs[2], sqlexec.ErrGuardrail)
+		assert.ElementsMatch(t, []string{sqls, sqls + " limit 1"}, server.Log())
+	})
+	t.Run("caller cancel", func(t *testing.T) {
+		db, server, release := openBlockingDB(t, t.Name(), "a")
+		sqls := "select name from service where id=1"
+		cancelCtx, cancel := context.WithCancel(ctx)
+		var canceledErr error
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, canceledErr = sqlexec.QueryContext(cancelCtx, db, sqls)
+		}()
+		var out string
+		var err error
+		waiting := make(chan struct{})
+		go func() {
+			defer close(waiting)
+			out, err = sqlexec.QueryContext(ctx, db, sqls)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		<-done
+		require.ErrorIs(t, canceledErr, context.Canceled)
+		close(release)
+		<-waiting
+		require.NoError(t, err)
+		assert.Equal(t, "a", out)
+		assert.Len(t, server.Log(), 1)
+	})
+	t.Run("executor setting", func(t *testing.T) {
+		db, _ := openFakeDB(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+			return &fakeResponse{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), []byte("a")}}}, nil
+		})
+		executor := sqlexec.NewExecutorSQLWithDB(db)
+		done := make(chan struct{})
+		go func() { // 执行期间修改设置
+			defer close(done)
+			for i := 0; i < 20; i++ {
+				executor.SetSingleflight(i%2 == 0)
+			}
+		}()
+		var out []map[string]string
+		for i := 0; i < 20; i++ {
+			require.NoError(t, executor.ExecOrQueryContext(ctx, "select id,name from service where id=1", &out))
+		}
+		<-done
+	})
+}
+
+func TestIsNonDeterministic(t *testing.T) {
+	for _, sqls := range []string{
+		"select now()",
+		"select * from t order by RAND() limit 1",
+		"select uuid()",
+		"select current_timestamp",
+		"select * from t where id=1 for update",
+		"select * from t where id=1 lock in share mode",
+	} {
+		assert.True(t, sqlexec.IsNonDeterministic(sqls), sqls)
+	}
+	for _, sqls := range []string{
+		"select * from t where id=1",
+		"select known() from t",
+		"select * from t where name='update'",
+	} {
+		assert.False(t, sqlexec.IsNonDeterministic(sqls), sqls)
+	}
+}
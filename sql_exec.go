@@ -5,105 +5,292 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"net"
+	"io"
 	"reflect"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/blastrain/vitess-sqlparser/sqlparser"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jfcote87/sshdb"
+	sshdbmysql "github.com/jfcote87/sshdb/mysql"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"github.com/spf13/cast"
-	"github.com/suifengpiao14/logchan/v2"
 	"github.com/suifengpiao14/sshmysql"
 	"github.com/tidwall/gjson"
-	"golang.org/x/sync/singleflight"
 	gormLogger "gorm.io/gorm/logger"
 )
 
-type DBConfig struct {
-	DSN         string `json:"dsn"`
-	LogLevel    string `json:"logLevel"`
-	Timeout     int    `json:"timeout"`
-	MaxOpen     int    `json:"maxOpen"`
-	MaxIdle     int    `json:"maxIdle"`
-	MaxIdleTime int    `json:"maxIdleTime"`
+type ExecutorSQL struct {
+	dbConfig      DBConfig
+	sshConfig     *sshmysql.SSHConfig
+	_db           *sql.DB
+	tunnel        io.Closer // ssh 隧道,Close 时关闭
+	replicas      *replicaSet
+	endpoint      endpoint // 当前使用的主库地址
+	mu            sync.Mutex
+	closed        bool
+	failingOver   bool // 正在探测候选地址,探测期间不持有 mu
+	backoffPolicy *BackoffPolicy
+	retryPolicy   *RetryPolicy
+	middlewares   []Middleware // 为nil 时使用 DefaultMiddlewares
+	bulkhead      *bulkhead
+	breaker       *circuitBreaker
+	guardrails    *GuardrailPolicy
+	resultMode    ResultMode
+	singleflight  *bool
+	stats         executorStats
+	metrics       *metricsRecorder
+	tracer        Tracer
+	sqlCommenter  *SQLCommenter
 }
 
 var (
-	ERROR_EMPTY_CONFIG = errors.New("empty db config")
+	ERROR_EXECUTOR_CLOSED = errors.New("executor closed")
 )
 
-//JsonToDBConfig 内置将json字符串转为DBConfig
-func JsonToDBConfig(s string) (c *DBConfig, err error) {
-	if strings.TrimSpace(s) == "" {
-		return nil, ERROR_EMPTY_CONFIG
+func (e *ExecutorSQL) TypeName() string {
+	return "ExecutorSQL"
+}
+
+func NewExecutorSQL(dbConfig DBConfig, sshConfig *sshmysql.SSHConfig) (e *ExecutorSQL) {
+	return &ExecutorSQL{
+		dbConfig:  dbConfig,
+		sshConfig: sshConfig,
+	}
+}
+
+// NewExecutorSQLWithDB 使用已创建的连接池,Close 时会关闭该连接池
+func NewExecutorSQLWithDB(db *sql.DB) (e *ExecutorSQL) {
+	return &ExecutorSQL{
+		_db: db,
 	}
-	c = &DBConfig{}
-	err = json.Unmarshal([]byte(s), c)
+}
+
+// DBConfig 获取配置
+func (e *ExecutorSQL) DBConfig() DBConfig {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dbConfig
+}
+
+// connectedDB 获取已建立的连接池,未连接时返回nil,不会触发连接
+func (e *ExecutorSQL) connectedDB() (db *sql.DB) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e._db
+}
+
+// SetBackoffPolicy 设置连接失败的重试策略,默认为 DefaultBackoffPolicy
+func (e *ExecutorSQL) SetBackoffPolicy(policy BackoffPolicy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.backoffPolicy = &policy
+}
+
+// Open 建立连接池并ping 数据库,网络错误按重试策略重试;已连接时直接返回,失败后可再次调用
+func (e *ExecutorSQL) Open(ctx context.Context) (err error) {
+	_, err = e.getDB(ctx)
+	return err
+}
+
+// GetDB 获取连接池,首次调用时连接数据库;连接失败返回错误,下次调用重新连接
+func (e *ExecutorSQL) GetDB() (db *sql.DB, err error) {
+	return e.getDB(context.Background())
+}
+
+// txOrPrimaryDB ctx 中存在本executor 开启的事务时返回事务的连接池(主库切换后同样如此,语句不会在事务外执行),否则返回主库
+func (e *ExecutorSQL) txOrPrimaryDB(ctx context.Context) (db *sql.DB, err error) {
+	if transaction, ok := ctx.Value(context_Key_Transaction).(*Transaction); ok && transaction.executor == e {
+		return transaction.db, nil
+	}
+	return e.getDB(ctx)
+}
+
+func (e *ExecutorSQL) getDB(ctx context.Context) (db *sql.DB, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil, ERROR_EXECUTOR_CLOSED
+	}
+	if e._db != nil {
+		return e._db, nil
+	}
+	policy := DefaultBackoffPolicy
+	if e.backoffPolicy != nil {
+		policy = *e.backoffPolicy
+	}
+	err = policy.Do(ctx, func(ctx context.Context) (err error) {
+		db, tunnel, ep, err := connectEndpoint(ctx, e.dbConfig, e.sshConfig, 0)
+		if err != nil {
+			return err
+		}
+		e.setPrimary(db, tunnel, ep)
+		return nil
+	})
 	if err != nil {
+		err = errors.WithMessage(err, "connect db")
 		return nil, err
 	}
-	err = c.Validate()
+	cfg := e.dbConfig
+	if len(cfg.Replicas) > 0 {
+		e.replicas = openReplicaSet(cfg, func(dsn string) (db *sql.DB, tunnel io.Closer, err error) {
+			return connectDB(DBConfig{DSN: dsn}, e.sshConfig)
+		})
+	}
+	return e._db, nil
+}
+
+// Ping 检查数据库连接,未连接时先连接
+func (e *ExecutorSQL) Ping(ctx context.Context) (err error) {
+	db, err := e.getDB(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return c, nil
+	return db.PingContext(ctx)
 }
 
-func (dbConfig DBConfig) Validate() (err error) {
-	if dbConfig.DSN == "" {
-		err = errors.Errorf("DBConfig.DSN required")
+// Close 关闭连接池和ssh 隧道,关闭后的 executor 不能再使用
+func (e *ExecutorSQL) Close() (err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	if e.replicas != nil {
+		err = e.replicas.close()
+		e.replicas = nil
+	}
+	if e._db == nil {
 		return err
 	}
-	return nil
+	if closeErr := closeDB(e._db, e.tunnel); err == nil {
+		err = closeErr
+	}
+	e._db, e.tunnel = nil, nil
+	return err
 }
 
-type ExecutorSQL struct {
-	dbConfig  DBConfig
-	sshConfig *sshmysql.SSHConfig
-	_db       *sql.DB
-	once      sync.Once
+// reconfigure 替换配置,已建立的主库、从库连接池由返回的函数关闭,下次使用时按新配置连接;
+// executor 本身不变,调用方设置的策略、中间件、统计等继续生效
+func (e *ExecutorSQL) reconfigure(dbConfig DBConfig, sshConfig *sshmysql.SSHConfig) (closeOld func() error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	db, tunnel, replicas := e._db, e.tunnel, e.replicas
+	e.dbConfig, e.sshConfig = dbConfig, sshConfig
+	e._db, e.tunnel, e.replicas, e.endpoint = nil, nil, nil, endpoint{}
+	return func() (err error) {
+		if replicas != nil {
+			err = replicas.close()
+		}
+		if db == nil {
+			return err
+		}
+		if closeErr := closeDB(db, tunnel); err == nil {
+			err = closeErr
+		}
+		return err
+	}
 }
 
-func (e *ExecutorSQL) TypeName() string {
-	return "ExecutorSQL"
+// SetResultMode 设置查询结果的值类型,单次调用可通过 WithResultMode 覆盖
+func (e *ExecutorSQL) SetResultMode(mode ResultMode) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resultMode = mode
 }
 
-func NewExecutorSQL(dbConfig DBConfig, sshConfig *sshmysql.SSHConfig) (e *ExecutorSQL) {
-	return &ExecutorSQL{
-		dbConfig:  dbConfig,
-		sshConfig: sshConfig,
+// SetSingleflight 设置是否合并相同的并发查询,单次调用可通过 WithSingleflight 覆盖
+func (e *ExecutorSQL) SetSingleflight(enable bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.singleflight = &enable
+}
+
+const (
+	context_Key_DBName contextKey = "sqlexec_db_name"
+)
+
+// WithDBName 设置本次调用的库名,用于追踪及按表结构解析错误;通过 ExecutorSQL 调用时默认为当前主库的库名
+func WithDBName(ctx context.Context, dbName string) context.Context {
+	return context.WithValue(ctx, context_Key_DBName, dbName)
+}
+
+func dbNameFromContext(ctx context.Context) (dbName string) {
+	dbName, _ = ctx.Value(context_Key_DBName).(string)
+	return dbName
+}
+
+// databaseName 当前主库的库名,未连接时使用配置的第一个地址
+func (e *ExecutorSQL) databaseName() (dbName string) {
+	e.mu.Lock()
+	dsn, dbConfig := e.endpoint.dsn, e.dbConfig
+	e.mu.Unlock()
+	if dsn == "" {
+		dsn, _ = dbConfig.GetDSN()
+	}
+	if cfg, err := mysql.ParseDSN(dsn); dsn != "" && err == nil {
+		return cfg.DBName
 	}
+	return dbConfig.Database
 }
 
-func (e *ExecutorSQL) GetDB() (db *sql.DB) {
-	e.once.Do(func() {
-		cfg := e.dbConfig
-		db, err := connectDB(cfg, e.sshConfig)
-		if err != nil {
-			if errors.Is(err, &net.OpError{}) {
-				err = nil
-				time.Sleep(100 * time.Millisecond)
-				db, err = connectDB(cfg, e.sshConfig)
-			}
-		}
-		if err != nil {
-			panic(err)
+// withExecutorContext 将executor 级别的配置写入ctx,调用方已在ctx 中设置的优先
+func (e *ExecutorSQL) withExecutorContext(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(context_Key_DBName).(string); !ok {
+		ctx = WithDBName(ctx, e.databaseName())
+	}
+	ctx = withStats(ctx, &e.stats) // 统计记录到实际执行语句的 executor
+	ctx = withMetrics(ctx, e.getMetrics())
+	ctx = e.withTracing(ctx)
+	ctx = e.withResilience(ctx)
+	ctx = e.withGuardrails(ctx)
+	e.mu.Lock()
+	resultMode, singleflight, sqlCommenter := e.resultMode, e.singleflight, e.sqlCommenter
+	e.mu.Unlock()
+	if _, ok := resultModeFromContext(ctx); !ok && resultMode != "" {
+		ctx = WithResultMode(ctx, resultMode)
+	}
+	if _, ok := singleflightFromContext(ctx); !ok && singleflight != nil {
+		ctx = WithSingleflight(ctx, *singleflight)
+	}
+	if _, ok := middlewaresFromContext(ctx); !ok {
+		if middlewares := e.getMiddlewares(); middlewares != nil {
+			ctx = WithMiddlewares(ctx, middlewares...)
 		}
-		sqlDB := db
-		sqlDB.SetMaxOpenConns(cfg.MaxOpen)
-		sqlDB.SetMaxIdleConns(cfg.MaxIdle)
-		sqlDB.SetConnMaxIdleTime(time.Duration(cfg.MaxIdleTime) * time.Minute)
-		e._db = db
-	})
-	return e._db
+	}
+	if _, ok := sqlCommenterFromContext(ctx); !ok && sqlCommenter != nil {
+		ctx = WithSQLCommenter(ctx, sqlCommenter)
+	}
+	cfg := e.DBConfig()
+	if _, ok := statementTimeoutFromContext(ctx); !ok && cfg.Timeout > 0 {
+		ctx = WithStatementTimeout(ctx, time.Duration(cfg.Timeout)*time.Second)
+	}
+	if _, ok := maxExecutionTimeHintFromContext(ctx); !ok && cfg.MaxExecutionTimeHint {
+		ctx = WithMaxExecutionTimeHint(ctx, true)
+	}
+	if _, ok := logLevelFromContext(ctx); !ok && cfg.LogLevel != "" {
+		ctx = WithLogLevel(ctx, LogLevel(cfg.LogLevel))
+	}
+	if _, ok := slowThresholdFromContext(ctx); !ok && cfg.SlowThreshold > 0 {
+		ctx = WithSlowThreshold(ctx, time.Duration(cfg.SlowThreshold)*time.Millisecond)
+	}
+	return ctx
 }
 
 func (e *ExecutorSQL) ExecOrQueryContext(ctx context.Context, sqls string, out interface{}) (err error) {
-	str, err := ExecOrQueryContext(ctx, e.GetDB(), sqls)
+	ctx = e.withExecutorContext(ctx)
+	ctx, _, _ = withParsedStatement(ctx, sqls) // 解析错误在执行时返回
+	var str string
+	err = e.withRetry(ctx, isRetryableStatement(ctx, sqls), func(ctx context.Context) (err error) {
+		return e.withRoutedDB(ctx, sqls, true, func(ctx context.Context, db *sql.DB) (err error) {
+			str, err = ExecOrQueryContext(ctx, db, sqls)
+			return err
+		})
+	})
 	if err != nil {
 		return err
 	}
@@ -114,15 +301,73 @@ func (e *ExecutorSQL) ExecOrQueryContext(ctx context.Context, sqls string, out i
 	return nil
 }
 
+// WithTransaction 使用当前db 开启事务，闭包内通过ctx 调用的sqlexec 方法共用该事务;设置 RetryPolicy 时失败的事务整体重试,闭包需可重复执行
+func (e *ExecutorSQL) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	ctx = e.withExecutorContext(ctx)
+	commitSent := false
+	canRetry := func(err error) bool {
+		return isRetryableTransaction(err, commitSent)
+	}
+	return e.withRetryIf(ctx, true, canRetry, func(ctx context.Context) (err error) { // 事务闭包整体重试,嵌套事务不重试
+		commitSent = false
+		db, err := e.txOrPrimaryDB(ctx)
+		if err != nil {
+			return err
+		}
+		markWritten(ctx)
+		connErr, err := callDB(ctx, db, func(ctx context.Context, db *sql.DB) (err error) {
+			return withTransaction(ctx, db, e, func(ctx context.Context) (err error) {
+				err = fn(ctx)
+				commitSent = err == nil // 闭包成功后提交
+				return err
+			})
+		})
+		if connErr != nil { // 只按事务语句的 driver 错误切换,闭包自身返回的错误不会触发切换
+			_ = e.failover(ctx, db, connErr)
+		}
+		return err
+	})
+}
+
 var DriverName = "mysql"
 
-func connectDB(cfg DBConfig, sshConfig *sshmysql.SSHConfig) (db *sql.DB, err error) {
-	if sshConfig != nil {
-		db, err = sshConfig.Tunnel(cfg.DSN)
-	} else {
-		db, err = sql.Open(DriverName, cfg.DSN)
+// connectDB 创建连接池,使用ssh 时同时返回隧道,关闭连接池后需要关闭隧道
+func connectDB(cfg DBConfig, sshConfig *sshmysql.SSHConfig) (db *sql.DB, tunnel io.Closer, err error) {
+	dsn, err := cfg.GetDSN()
+	if err != nil {
+		return nil, nil, err
+	}
+	if sshConfig == nil {
+		db, err = sql.Open(DriverName, dsn)
+		return db, nil, err
+	}
+	clientConfig, err := sshConfig.Config()
+	if err != nil {
+		return nil, nil, err
+	}
+	sshTunnel, err := sshdb.New(clientConfig, sshConfig.Address)
+	if err != nil {
+		return nil, nil, err
 	}
-	return db, err
+	sshTunnel.IgnoreSetDeadlineRequest(true)
+	connector, err := sshTunnel.OpenConnector(sshdbmysql.TunnelDriver, dsn)
+	if err != nil {
+		sshTunnel.Close()
+		err = errors.WithMessagef(err, "dsn:%s", dsn)
+		return nil, nil, err
+	}
+	db = sql.OpenDB(connector)
+	return db, sshTunnel, nil
+}
+
+func closeDB(db *sql.DB, tunnel io.Closer) (err error) {
+	err = db.Close()
+	if tunnel != nil {
+		if tunnelErr := tunnel.Close(); err == nil {
+			err = tunnelErr
+		}
+	}
+	return err
 }
 
 func byte2Struct(data []byte, dst any) (err error) {
@@ -150,160 +395,122 @@ func byte2Struct(data []byte, dst any) (err error) {
 	return nil
 }
 
-var execOrQueryContextSingleflight = new(singleflight.Group)
-
-func ExecOrQueryContext(ctx context.Context, db *sql.DB, sqls string) (out string, err error) {
-	sqlLogInfo := &LogInfoEXECSQL{}
-	defer func() {
-		sqlLogInfo.Err = err
-		logchan.SendLogInfo(sqlLogInfo)
-	}()
+// ExecOrQueryContext 执行sql,args 为?占位符对应的参数
+func ExecOrQueryContext(ctx context.Context, db *sql.DB, sqls string, args ...any) (out string, err error) {
 	//sqls = funcs.StandardizeSpaces(funcs.TrimSpaces(sqls)) // 格式化sql语句 // 语句中间的\n \t 等保持，比如保存http协议，就必须保存\n,如果get请求，只有header，没有body，最后的\r\n 也必须保留，所以注释这个地方
-	stmt, err := sqlparser.Parse(sqls)
+	ctx, stmt, err := withParsedStatement(ctx, sqls) // 日志由 LoggingMiddleware 记录
 	if err != nil {
-		return "", errors.WithMessage(err, sqls)
-	}
-	sqlLogInfo.SQL = sqls
-	switch stmt.(type) {
-	case *sqlparser.Select:
-		return QueryContext(ctx, db, sqls)
-	case *sqlparser.Update:
-		_, rowsAffected, err := ExecContext(ctx, db, sqls)
-		if err != nil {
-			return "", err
-		}
-		return cast.ToString(rowsAffected), nil
-	case *sqlparser.Insert:
-		lastInsertId, rowsAffected, err := ExecContext(ctx, db, sqls)
+		return "", err
+	}
+	if stmt.Type.IsQuery() {
+		return QueryContext(ctx, db, sqls, args...)
+	}
+	switch stmt.Type {
+	case StatementType_Insert, StatementType_Replace:
+		result, err := insertContext(ctx, db, stmt, args...)
 		if err != nil {
 			return "", err
 		}
-		insertIdArr := make([]string, 0)
-		for i := int64(0); i < rowsAffected; i++ {
-			insertIdArr = append(insertIdArr, cast.ToString(lastInsertId+i))
-		}
-		b, err := json.Marshal(insertIdArr)
+		b, err := json.Marshal(result)
 		if err != nil {
 			return "", err
 		}
 		out = string(b)
 		return out, nil
-
-	case *sqlparser.Delete:
-		_, rowsAffected, err := ExecContext(ctx, db, sqls)
+	case StatementType_Update, StatementType_Delete, StatementType_DDL, StatementType_Set:
+		_, rowsAffected, err := ExecContext(ctx, db, sqls, args...)
 		if err != nil {
 			return "", err
 		}
 		return cast.ToString(rowsAffected), nil
 	}
-
-	return out, nil
+	err = errors.WithMessagef(ERROR_UNSUPPORTED_STATEMENT, "type:%s,sql:%s", stmt.Type, sqls)
+	return "", err
 }
 
-func ExecContext(ctx context.Context, db *sql.DB, sqls string) (lastInsertId int64, rowsAffected int64, err error) {
-	sqlLogInfo := &LogInfoEXECSQL{
-		SQL: sqls,
-	}
-	defer func() {
-		sqlLogInfo.Err = err
-		logchan.SendLogInfo(sqlLogInfo)
-	}()
-
-	sqlLogInfo.BeginAt = time.Now().Local()
-	res, err := db.ExecContext(ctx, sqls)
+// ExecContext 经过中间件执行写语句,返回最后插入的id和影响行数
+func ExecContext(ctx context.Context, db *sql.DB, sqls string, args ...any) (lastInsertId int64, rowsAffected int64, err error) {
+	output, err := runStatement(ctx, db, CallKind_Exec, sqls, args, nil)
 	if err != nil {
 		return 0, 0, err
 	}
-	sqlLogInfo.EndAt = time.Now().Local()
-	lastInsertId, _ = res.LastInsertId()
-	rowsAffected, _ = res.RowsAffected()
+	return output.LastInsertId, output.RowsAffected, nil
+}
 
-	sqlLogInfo.RowsAffected = rowsAffected
-	sqlLogInfo.LastInsertId = lastInsertId
-	return lastInsertId, rowsAffected, nil
+// QueryContext 经过中间件执行查询,返回结果json
+func QueryContext(ctx context.Context, db *sql.DB, sqls string, args ...any) (out string, err error) {
+	output, err := runStatement(ctx, db, CallKind_Query, sqls, args, nil)
+	if err != nil {
+		return "", err
+	}
+	return output.Out, nil
+}
 
+// queryOutput 查询结果,合并查询时多个调用方共享,不能修改
+type queryOutput struct {
+	out          string
+	rowsAffected int64
 }
 
-func QueryContext(ctx context.Context, db *sql.DB, sqls string) (out string, err error) {
-	sqlLogInfo := &LogInfoEXECSQL{
-		SQL: sqls,
+func queryResult(ctx context.Context, executor sqlExecutor, mode ResultMode, sqls string, args ...any) (result *queryOutput, err error) {
+	rows, err := executor.QueryContext(ctx, sqls, args...)
+	if err != nil {
+		return nil, err
 	}
 	defer func() {
-		sqlLogInfo.Err = err
-		logchan.SendLogInfo(sqlLogInfo)
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
 	}()
-
-	v, err, _ := execOrQueryContextSingleflight.Do(sqls, func() (interface{}, error) {
-		sqlLogInfo.BeginAt = time.Now().Local()
-		rows, err := db.QueryContext(ctx, sqls)
-		sqlLogInfo.EndAt = time.Now().Local()
+	result = &queryOutput{}
+	allResult := make([][]map[string]any, 0)
+	for {
+		scanner, err := newRowScanner(rows, mode)
 		if err != nil {
-			return out, err
+			return nil, err
 		}
-		defer func() {
-			err := rows.Close()
+		records := make([]map[string]any, 0)
+		for rows.Next() {
+			result.rowsAffected++
+			record, err := scanner.scan(rows)
 			if err != nil {
-				panic(err)
-			}
-		}()
-		allResult := make([][]map[string]string, 0)
-		rowsAffected := 0
-		for {
-			records := make([]map[string]string, 0)
-			for rows.Next() {
-				rowsAffected++
-				var record = make(map[string]interface{})
-				var recordStr = make(map[string]string)
-				err := sqlx.MapScan(rows, record)
-				if err != nil {
-					return out, err
-				}
-				for k, v := range record {
-					recordStr[k] = cast.ToString(v)
-				}
-
-				records = append(records, recordStr)
-			}
-			allResult = append(allResult, records)
-			if !rows.NextResultSet() {
-				break
+				return nil, err
 			}
+			records = append(records, record)
 		}
-		sqlLogInfo.RowsAffected = int64(rowsAffected)
-		if len(allResult) == 1 { // allResult 初始值为[[]],至少有一个元素
-			result := allResult[0]
-			if len(result) == 0 { // 结果为空，返回空字符串
-				return out, nil
-			}
-			if len(result) == 1 && len(result[0]) == 1 {
-				row := result[0]
-				for _, val := range row {
-					return val, nil // 只有一个值时，直接返回值本身
-				}
-			}
-			b, err := json.Marshal(result)
-			if err != nil {
-				return out, err
+		allResult = append(allResult, records)
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(allResult) == 1 { // allResult 初始值为[[]],至少有一个元素
+		records := allResult[0]
+		if len(records) == 0 { // 结果为空，返回空字符串
+			return result, nil
+		}
+		if len(records) == 1 && len(records[0]) == 1 {
+			for _, val := range records[0] {
+				result.out, err = singleValue(mode, val) // 只有一个值时，直接返回值本身
+				return result, err
 			}
-			out = string(b)
-			sqlLogInfo.Result = out
-			return out, nil
 		}
-
-		jsonByte, err := json.Marshal(allResult)
+		b, err := json.Marshal(records)
 		if err != nil {
-			return out, err
+			return nil, err
 		}
-		out = string(jsonByte)
-		sqlLogInfo.Result = out
-
-		return out, nil
-	})
+		result.out = string(b)
+		return result, nil
+	}
+	b, err := json.Marshal(allResult)
 	if err != nil {
-		return out, err
+		return nil, err
 	}
-	out = v.(string)
-	return out, nil
+	result.out = string(b)
+	return result, nil
 }
 
 // ExplainSQL 将字named sql,数据整合为sql
@@ -318,7 +525,7 @@ func ExplainSQL(namedSql string, namedData map[string]any) (sql string, err erro
 	return sql, nil
 }
 
-//ExplainNamedSQL 带占位符的sql模板绑定数据后转换为常规sql(可以替换ExplainSQL,相比ExplainSQL 能更好的支持in 条件查询) 调用前可以先使用MysqlRealEscapeString 转义字符
+// ExplainNamedSQL 带占位符的sql模板绑定数据后转换为常规sql(可以替换ExplainSQL,相比ExplainSQL 能更好的支持in 条件查询) 调用前可以先使用MysqlRealEscapeString 转义字符
 func ExplainNamedSQL(namedSQL string, namedData map[string]any) (string, error) {
 	stmt, err := sqlparser.Parse(namedSQL)
 	if err != nil {
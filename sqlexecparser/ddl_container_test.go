@@ -71,3 +71,23 @@ func TestGetDBNameFromDSN(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, dbname, "xyxz_manage_db")
 }
+
+func TestTableKeys(t *testing.T) {
+	tables, err := sqlexecparser.ParseDDL(createDDLStr)
+	require.NoError(t, err)
+	for _, table := range tables {
+		if table.TableName != "window" {
+			continue
+		}
+		columnNames, ok := table.GetKeyColumnNames("UK_POSITION")
+		require.True(t, ok)
+		assert.Equal(t, []string{"position", "deleted_at"}, columnNames.ToString())
+		columnNames, ok = table.GetKeyColumnNames("PRIMARY")
+		require.True(t, ok)
+		assert.Equal(t, []string{"id"}, columnNames.ToString())
+		_, ok = table.GetKeyColumnNames("ik_unknown")
+		assert.False(t, ok)
+		return
+	}
+	t.Fatal("table window not found")
+}
@@ -42,39 +42,47 @@ func ParseDDL(ddls string) (tables Tables, err error) {
 
 }
 
-// splitDDLStatements 使用逐个字符读取方式分割 DDL 语句（排除在引号内的分号）
-func splitDDLStatements(batchDDL string) []string {
-	var statements []string
-	var currentStatement strings.Builder
-	var insideSingleQuote, insideDoubleQuote bool
-	batchDDL = fmt.Sprintf("%s;", batchDDL) // 最后增加; 确保 最后一个currentStatement 数据也收集了（因为后面有去除空白语句，所以多个;不影响结果）
-	for _, char := range batchDDL {
-		currentStatement.WriteRune(char)
-
-		switch char {
-		case ';':
-			if !insideSingleQuote && !insideDoubleQuote {
-				s := currentStatement.String()
-				statements = append(statements, s)
-				currentStatement.Reset()
-			}
-		case '\'':
-			insideSingleQuote = !insideSingleQuote
-		case '"':
-			insideDoubleQuote = !insideDoubleQuote
+// SplitStatements 逐个片段读取并分割多条语句,引号、反引号、注释内的分隔符不做分割,支持 DELIMITER 指令修改分隔符;返回的语句不含分隔符,只有注释的语句会被丢弃
+func SplitStatements(script string) []string {
+	statements := make([]string, 0)
+	delimiter := ";"
+	start := 0          // 当前语句的开始位置
+	hasContent := false // 当前语句是否有注释以外的内容
+	flush := func(end int) {
+		trimmed := strings.TrimSpace(script[start:end])
+		if hasContent && trimmed != "" {
+			statements = append(statements, trimmed)
 		}
+		hasContent = false
 	}
-
-	// 去除空白语句
-	var nonEmptyStatements []string
-	for _, statement := range statements {
-		trimmed := strings.TrimSpace(statement)
-		if trimmed != "" {
-			nonEmptyStatements = append(nonEmptyStatements, trimmed)
+	for i := 0; i < len(script); {
+		switch {
+		case !hasContent && hasPrefixFold(script[i:], "delimiter") && i+9 < len(script) && isSpace(script[i+9]):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script)
+			} else {
+				end += i
+			}
+			newDelimiter := strings.TrimSpace(script[i+9 : end])
+			if newDelimiter != "" {
+				delimiter = newDelimiter
+			}
+			start, i = end, end
+		case hasPrefixFold(script[i:], delimiter):
+			flush(i)
+			i += len(delimiter)
+			start = i
+		default:
+			kind, end := NextSegment(script, i)
+			if kind != Segment_Comment && kind != Segment_LineComment && !isSpace(script[i]) {
+				hasContent = true
+			}
+			i = end
 		}
 	}
-
-	return nonEmptyStatements
+	flush(len(script))
+	return statements
 }
 
 const (
@@ -87,7 +95,7 @@ const (
 func TryExecDDLs(ddls string) (db *executor.Executor, err error) {
 	conf := executor.NewDefaultConfig()
 	db = executor.NewExecutor(conf)
-	sqls := splitDDLStatements(ddls)
+	sqls := SplitStatements(ddls)
 	for _, sql := range sqls {
 		if sql == "" {
 			continue
@@ -236,13 +244,16 @@ func ConvertTabDef2Table(tableDef executor.TableDef) (table *Table, err error) {
 		Columns:     make(Columns, 0),
 		Comment:     tableDef.Comment,
 		Constraints: make(Constraints, 0),
+		Keys:        make(Keys, 0),
 	}
 	for _, indice := range tableDef.Indices {
 		switch indice.Key {
 		case executor.IndexType_PRI:
 			table.Constraints.Add(Constraint_Type_Primary, ToColumnName(indice.Columns...)...)
+			table.Keys = append(table.Keys, Key{Name: indice.Name, Type: Constraint_Type_Primary, ColumnNames: ToColumnName(indice.Columns...)})
 		case executor.IndexType_UNI:
 			table.Constraints.Add(Constraint_Type_Uniqueue, ToColumnName(indice.Columns...)...)
+			table.Keys = append(table.Keys, Key{Name: indice.Name, Type: Constraint_Type_Uniqueue, ColumnNames: ToColumnName(indice.Columns...)})
 		}
 	}
 	for _, columnDef := range tableDef.Columns {
@@ -31,3 +31,24 @@ func TestTryExecDDLs2(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, 5, len(tables))
 }
+
+func TestSplitStatements(t *testing.T) {
+	script := "-- 注释;\n" +
+		"insert into t (name) values('a;b'), (\"c\\\";d\");\n" +
+		"select `x;y` from t /* ; */ where id=1;\n" +
+		"# only comment;\n" +
+		"DELIMITER $$\n" +
+		"create procedure p() begin select 1; select 2; end$$\n" +
+		"delimiter ;\n" +
+		"update t set name='it''s;' where id=2;\n" +
+		"select 1--1;select 2"
+	statements := sqlexecparser.SplitStatements(script)
+	assert.Equal(t, []string{
+		"-- 注释;\ninsert into t (name) values('a;b'), (\"c\\\";d\")",
+		"select `x;y` from t /* ; */ where id=1",
+		"create procedure p() begin select 1; select 2; end",
+		"update t set name='it''s;' where id=2",
+		"select 1--1",
+		"select 2",
+	}, statements)
+}
@@ -24,6 +24,7 @@ type Table struct {
 	Columns     Columns     `json:"columns"`
 	Comment     string      `json:"comment"`
 	Constraints Constraints `json:"constraints"`
+	Keys        Keys        `json:"keys"` // 主键、唯一键,按索引名区分
 }
 
 func (t Table) Fullname() (fullname string) {
@@ -94,6 +95,38 @@ func (t Table) GetUniqKey() (columns Columns, err error) {
 	return columns, nil
 }
 
+// Key 主键或唯一键,Name 为索引名,主键为 PRIMARY
+type Key struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	ColumnNames ColumnNames `json:"columnNames"`
+}
+
+type Keys []Key
+
+// GetByName 按索引名获取键,不区分大小写
+func (ks Keys) GetByName(name string) (key *Key, ok bool) {
+	for _, k := range ks {
+		if strings.EqualFold(k.Name, name) {
+			return &k, true
+		}
+	}
+	return nil, false
+}
+
+// GetKeyColumnNames 获取索引对应的列名,Keys 中没有时 PRIMARY 使用主键约束的列
+func (t Table) GetKeyColumnNames(keyName string) (columnNames ColumnNames, ok bool) {
+	if key, ok := t.Keys.GetByName(keyName); ok {
+		return key.ColumnNames, true
+	}
+	if strings.EqualFold(keyName, "PRIMARY") {
+		if c, ok := t.Constraints.GetByType(Constraint_Type_Primary); ok {
+			return c.ColumnNames, true
+		}
+	}
+	return nil, false
+}
+
 type Constraints []Constraint
 
 type Constraint struct {
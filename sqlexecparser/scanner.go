@@ -0,0 +1,104 @@
+package sqlexecparser
+
+import "strings"
+
+// SegmentKind sql 片段类型
+type SegmentKind int
+
+const (
+	Segment_Code        SegmentKind = iota // 引号、注释之外的单个字节
+	Segment_String                         // 单引号、双引号字符串常量,支持反斜杠转义和连续两个引号转义
+	Segment_Identifier                     // 反引号标识符,连续两个反引号转义
+	Segment_Comment                        // /* */ 块注释(含 /*! */、/*+ */)
+	Segment_LineComment                    // # 及 -- 单行注释,-- 后面需要空白或控制字符,不含换行符
+)
+
+// NextSegment 返回从 start 开始的片段类型及结束位置(不含);未闭合的引号、块注释到sqls 末尾结束。
+// 引号、注释的判断规则与 MySQL 相同,所有需要跳过引号、注释的扫描都应使用该函数
+func NextSegment(sqls string, start int) (kind SegmentKind, end int) {
+	c := sqls[start]
+	switch {
+	case c == '\'' || c == '"':
+		return Segment_String, quotedEnd(sqls, start, true)
+	case c == '`':
+		return Segment_Identifier, quotedEnd(sqls, start, false)
+	case c == '#' || isDashComment(sqls, start):
+		end = strings.IndexAny(sqls[start:], "\r\n")
+		if end < 0 {
+			return Segment_LineComment, len(sqls)
+		}
+		return Segment_LineComment, start + end
+	case c == '/' && strings.HasPrefix(sqls[start:], "/*"):
+		end = strings.Index(sqls[start+2:], "*/")
+		if end < 0 {
+			return Segment_Comment, len(sqls)
+		}
+		return Segment_Comment, start + 2 + end + 2
+	}
+	return Segment_Code, start + 1
+}
+
+// isDashComment -- 后面为空白、控制字符或语句结束时才是注释,如 a--1 为 a - (-1)
+func isDashComment(sqls string, start int) bool {
+	if !strings.HasPrefix(sqls[start:], "--") {
+		return false
+	}
+	return start+2 == len(sqls) || sqls[start+2] <= ' '
+}
+
+// quotedEnd 引号的结束位置(不含),backslash 为true 时支持反斜杠转义
+func quotedEnd(sqls string, start int, backslash bool) (end int) {
+	quote := sqls[start]
+	for end = start + 1; end < len(sqls); end++ {
+		switch sqls[end] {
+		case '\\':
+			if backslash {
+				end++
+			}
+		case quote:
+			if end+1 < len(sqls) && sqls[end+1] == quote {
+				end++
+				continue
+			}
+			return end + 1
+		}
+	}
+	return len(sqls)
+}
+
+// SkipSpaceAndComments 跳过 start 开始的空白和注释,返回之后第一个字节的位置
+func SkipSpaceAndComments(sqls string, start int) (index int) {
+	for index = start; index < len(sqls); {
+		switch kind, end := NextSegment(sqls, index); {
+		case kind == Segment_Comment || kind == Segment_LineComment:
+			index = end
+		case isSpace(sqls[index]):
+			index++
+		default:
+			return index
+		}
+	}
+	return index
+}
+
+// EndsWithLineComment 语句的最后一个片段是否为单行注释,追加内容前需要换行
+func EndsWithLineComment(sqls string) bool {
+	last := Segment_Code
+	for i := 0; i < len(sqls); {
+		kind, end := NextSegment(sqls, i)
+		if kind != Segment_Code || !isSpace(sqls[i]) {
+			last = kind
+		}
+		i = end
+	}
+	return last == Segment_LineComment
+}
+
+// hasPrefixFold 忽略大小写判断前缀
+func hasPrefixFold(s string, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == '\v'
+}
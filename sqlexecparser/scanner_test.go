@@ -0,0 +1,47 @@
+package sqlexecparser_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/suifengpiao14/sqlexec/sqlexecparser"
+)
+
+func TestNextSegment(t *testing.T) {
+	cases := []struct {
+		sql  string
+		kind sqlexecparser.SegmentKind
+		end  int
+	}{
+		{`'it''s' x`, sqlexecparser.Segment_String, 7},
+		{`"a\"b" x`, sqlexecparser.Segment_String, 6},
+		{"`a``b\\` x", sqlexecparser.Segment_Identifier, 7},
+		{"'open", sqlexecparser.Segment_String, 5},
+		{"# x\nselect", sqlexecparser.Segment_LineComment, 3},
+		{"-- x\r\nselect", sqlexecparser.Segment_LineComment, 4},
+		{"--", sqlexecparser.Segment_LineComment, 2},
+		{"--1", sqlexecparser.Segment_Code, 1},
+		{"/* ' */ x", sqlexecparser.Segment_Comment, 7},
+		{"/*+ open", sqlexecparser.Segment_Comment, 8},
+		{"/ 2", sqlexecparser.Segment_Code, 1},
+	}
+	for _, c := range cases {
+		kind, end := sqlexecparser.NextSegment(c.sql, 0)
+		assert.Equal(t, c.kind, kind, c.sql)
+		assert.Equal(t, c.end, end, c.sql)
+	}
+}
+
+func TestEndsWithLineComment(t *testing.T) {
+	assert.True(t, sqlexecparser.EndsWithLineComment("select 1 # x"))
+	assert.True(t, sqlexecparser.EndsWithLineComment("select 1 -- x\n"))
+	assert.False(t, sqlexecparser.EndsWithLineComment("select '#', a--1"))
+	assert.False(t, sqlexecparser.EndsWithLineComment("select 1 -- x\nfrom t"))
+	assert.False(t, sqlexecparser.EndsWithLineComment("select 1 /* -- x */"))
+}
+
+func TestSkipSpaceAndComments(t *testing.T) {
+	sql := " /* a */ -- b\n # c\n select"
+	assert.Equal(t, len(sql)-len("select"), sqlexecparser.SkipSpaceAndComments(sql, 0))
+	assert.Equal(t, 3, sqlexecparser.SkipSpaceAndComments(" \t\n", 0))
+}
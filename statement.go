@@ -0,0 +1,237 @@
+package sqlexec
+
+import (
+	"strings"
+
+	"github.com/blastrain/vitess-sqlparser/sqlparser"
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/sqlexec/sqlexecparser"
+)
+
+// StatementType 语句类型,决定执行方式和输出格式
+type StatementType string
+
+const (
+	StatementType_Select  StatementType = "select"  // select、union、with ... select,输出行数据json
+	StatementType_Show    StatementType = "show"    // show、describe、explain 及 check、checksum 等只读的表检查语句,输出行数据json
+	StatementType_Call    StatementType = "call"    // 存储过程,可能返回多个结果集,输出行数据json
+	StatementType_Insert  StatementType = "insert"  // insert(含 on duplicate key update、ignore),输出插入的id
+	StatementType_Replace StatementType = "replace" // replace,输出插入的id
+	StatementType_Update  StatementType = "update"  // 输出影响行数
+	StatementType_Delete  StatementType = "delete"  // 输出影响行数
+	StatementType_DDL     StatementType = "ddl"     // create、alter、drop、truncate、rename,输出影响行数
+	StatementType_Set     StatementType = "set"     // set,输出影响行数
+	// StatementType_Maintenance optimize、repair、analyze 等会修改表的维护语句,按写语句处理,输出每个表的处理结果行数据json
+	StatementType_Maintenance StatementType = "maintenance"
+)
+
+// IsQuery 是否返回结果集
+func (t StatementType) IsQuery() bool {
+	switch t {
+	case StatementType_Select, StatementType_Show, StatementType_Call, StatementType_Maintenance:
+		return true
+	}
+	return false
+}
+
+var (
+	ERROR_UNSUPPORTED_STATEMENT = errors.New("unsupported statement")
+)
+
+// statementKeywords 语句首个关键词对应的类型
+var statementKeywords = map[string]StatementType{
+	"select":   StatementType_Select,
+	"with":     StatementType_Select,
+	"values":   StatementType_Select,
+	"table":    StatementType_Select,
+	"show":     StatementType_Show,
+	"describe": StatementType_Show,
+	"desc":     StatementType_Show,
+	"explain":  StatementType_Show,
+	"check":    StatementType_Show,
+	"checksum": StatementType_Show,
+	"call":     StatementType_Call,
+	"insert":   StatementType_Insert,
+	"replace":  StatementType_Replace,
+	"update":   StatementType_Update,
+	"delete":   StatementType_Delete,
+	"create":   StatementType_DDL,
+	"alter":    StatementType_DDL,
+	"drop":     StatementType_DDL,
+	"truncate": StatementType_DDL,
+	"rename":   StatementType_DDL,
+	"optimize": StatementType_Maintenance, // 重建表
+	"repair":   StatementType_Maintenance, // 修复表
+	"analyze":  StatementType_Maintenance, // 更新索引统计信息,加读锁
+	"set":      StatementType_Set,
+	// use 会修改连接池中某个连接的默认库,影响之后使用该连接的调用,不支持
+}
+
+// Statement 解析后的语句
+type Statement struct {
+	SQL  string              `json:"sql"`
+	Type StatementType       `json:"type"`
+	AST  sqlparser.Statement `json:"-"` // sqlparser 不支持的语句(set、call、with 等)为nil
+}
+
+// ParseStatement 按首个关键词确定语句类型(with 按公共表表达式之后的主语句),同时尝试解析语法树;
+// 事务控制、锁表、use 及无法识别的语句返回 ERROR_UNSUPPORTED_STATEMENT
+func ParseStatement(sqls string) (stmt *Statement, err error) {
+	keyword := firstKeyword(sqls)
+	if keyword == "with" {
+		keyword = withMainKeyword(sqls)
+	}
+	typ, ok := statementKeywords[keyword]
+	if !ok {
+		err = errors.WithMessagef(ERROR_UNSUPPORTED_STATEMENT, "keyword:%s,sql:%s", keyword, sqls)
+		return nil, err
+	}
+	stmt = &Statement{
+		SQL:  sqls,
+		Type: typ,
+	}
+	stmt.AST, _ = parseAST(sqls) // 语法树仅用于辅助分析,解析失败不影响执行
+	return stmt, nil
+}
+
+// withMainKeywords with 之后可以出现的主语句关键词
+var withMainKeywords = map[string]bool{"select": true, "table": true, "values": true, "update": true, "delete": true, "insert": true, "replace": true}
+
+// withMainKeyword with 语句跳过公共表表达式后的主语句关键词(小写);括号、引号、注释内的内容不参与判断,找不到时返回空
+func withMainKeyword(sqls string) (keyword string) {
+	depth := 0
+	for i := 0; i < len(sqls); {
+		c := sqls[i]
+		switch {
+		case c == '(':
+			depth++
+			i++
+		case c == ')':
+			depth--
+			i++
+		case isKeywordByte(c):
+			end := i
+			for end < len(sqls) && isKeywordByte(sqls[end]) {
+				end++
+			}
+			word := strings.ToLower(sqls[i:end])
+			if depth == 0 && withMainKeywords[word] {
+				return word
+			}
+			i = end
+		default:
+			_, i = sqlexecparser.NextSegment(sqls, i)
+		}
+	}
+	return ""
+}
+
+func isKeywordByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// parseAST sqlparser 对部分语句(如 show tables)会panic,此处转为错误
+func parseAST(sqls string) (ast sqlparser.Statement, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("sqlparser panic:%v", r)
+		}
+	}()
+	return sqlparser.Parse(sqls)
+}
+
+// firstKeyword 获取语句的首个关键词(小写),跳过开头的空白、注释和括号
+func firstKeyword(sqls string) (keyword string) {
+	keyword, _ = firstKeywordEnd(sqls)
+	return keyword
+}
+
+// firstKeywordEnd 获取语句的首个关键词(小写)及其在sqls 中的结束位置
+func firstKeywordEnd(sqls string) (keyword string, end int) {
+	start := sqlexecparser.SkipSpaceAndComments(sqls, 0)
+	for start < len(sqls) && sqls[start] == '(' {
+		start = sqlexecparser.SkipSpaceAndComments(sqls, start+1)
+	}
+	for end = start; end < len(sqls); end++ {
+		if c := sqls[end]; !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')) {
+			break
+		}
+	}
+	return strings.ToLower(sqls[start:end]), end
+}
+
+// Tables 语句涉及的表名(按出现顺序去重,带库名时为 库名.表名),没有语法树时返回空
+func (stmt *Statement) Tables() (tables []string) {
+	tables = make([]string, 0)
+	if stmt.AST == nil {
+		return tables
+	}
+	seen := make(map[string]bool)
+	add := func(tableName sqlparser.TableName) {
+		if tableName.IsEmpty() {
+			return
+		}
+		table := tableName.Name.String()
+		if !tableName.Qualifier.IsEmpty() {
+			table = tableName.Qualifier.String() + "." + table
+		}
+		if !seen[table] {
+			seen[table] = true
+			tables = append(tables, table)
+		}
+	}
+	switch ast := stmt.AST.(type) {
+	case *sqlparser.Insert:
+		add(ast.Table)
+	case *sqlparser.DDL:
+		add(ast.Table)
+		add(ast.NewName)
+	}
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if expr, ok := node.(*sqlparser.AliasedTableExpr); ok { // 列名的限定符也是 TableName,只取 from、join 中的表
+			if tableName, ok := expr.Expr.(sqlparser.TableName); ok {
+				add(tableName)
+			}
+		}
+		return true, nil
+	}, stmt.AST)
+	return tables
+}
+
+// NormalizeSQL 将字符串、数字常量替换为?,去掉注释并合并连续空白,用于追踪、统计时聚合相同结构的语句且不暴露数据
+func NormalizeSQL(sqls string) (normalized string) {
+	var w strings.Builder
+	w.Grow(len(sqls))
+	isIdent := func(b byte) bool {
+		return b == '_' || b == '$' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || b >= 0x80
+	}
+	space := false
+	for i := 0; i < len(sqls); {
+		c := sqls[i]
+		kind, end := sqlexecparser.NextSegment(sqls, i)
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' || kind == sqlexecparser.Segment_Comment || kind == sqlexecparser.Segment_LineComment {
+			space = true
+			i = end
+			continue
+		}
+		if space && w.Len() > 0 {
+			w.WriteByte(' ')
+		}
+		space = false
+		switch {
+		case kind == sqlexecparser.Segment_String:
+			w.WriteByte('?')
+		case kind == sqlexecparser.Segment_Identifier:
+			w.WriteString(sqls[i:end])
+		case c >= '0' && c <= '9' && (i == 0 || !isIdent(sqls[i-1])):
+			for end < len(sqls) && (isIdent(sqls[end]) || sqls[end] == '.') {
+				end++
+			}
+			w.WriteByte('?')
+		default:
+			w.WriteByte(c)
+		}
+		i = end
+	}
+	return w.String()
+}
@@ -0,0 +1,117 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestParseStatement(t *testing.T) {
+	cases := []struct {
+		sql string
+		typ sqlexec.StatementType
+	}{
+		{"select * from service where id=1", sqlexec.StatementType_Select},
+		{"(select 1) union all (select 2) limit 1", sqlexec.StatementType_Select},
+		{"with t as (select 1) select * from t", sqlexec.StatementType_Select},
+		{"with x as (select 1) delete from service", sqlexec.StatementType_Delete},
+		{"WITH x AS (select id from `update`), y (a) AS (select 'delete') UPDATE service set name='a' where id in (select id from x)", sqlexec.StatementType_Update},
+		{"with recursive x as (select 1 union all select n+1 from x where n<3) insert into t select * from x", sqlexec.StatementType_Insert},
+		{"/* comment */ -- line\n SELECT 1", sqlexec.StatementType_Select},
+		{"show tables", sqlexec.StatementType_Show},
+		{"describe service", sqlexec.StatementType_Show},
+		{"desc service", sqlexec.StatementType_Show},
+		{"explain select * from service", sqlexec.StatementType_Show},
+		{"call list_service(1)", sqlexec.StatementType_Call},
+		{"insert into service (name) values('a')", sqlexec.StatementType_Insert},
+		{"insert into service (id,name) values(1,'a') on duplicate key update name=values(name)", sqlexec.StatementType_Insert},
+		{"replace into service (id,name) values(1,'a')", sqlexec.StatementType_Replace},
+		{"update service set name='a' where id=1", sqlexec.StatementType_Update},
+		{"delete from service where id=1", sqlexec.StatementType_Delete},
+		{"create table t (id int)", sqlexec.StatementType_DDL},
+		{"alter table t add column name varchar(10)", sqlexec.StatementType_DDL},
+		{"drop table t", sqlexec.StatementType_DDL},
+		{"truncate table t", sqlexec.StatementType_DDL},
+		{"optimize table service", sqlexec.StatementType_Maintenance},
+		{"repair table service", sqlexec.StatementType_Maintenance},
+		{"analyze table service", sqlexec.StatementType_Maintenance},
+		{"check table service", sqlexec.StatementType_Show},
+		{"checksum table service", sqlexec.StatementType_Show},
+		{"set names utf8mb4", sqlexec.StatementType_Set},
+	}
+	for _, c := range cases {
+		stmt, err := sqlexec.ParseStatement(c.sql)
+		require.NoError(t, err, c.sql)
+		assert.Equal(t, c.typ, stmt.Type, c.sql)
+	}
+	for _, sql := range []string{"begin", "start transaction", "commit", "lock tables t write", "use curdservice", "with x as (select 1)", "foo bar"} {
+		_, err := sqlexec.ParseStatement(sql)
+		require.ErrorIs(t, err, sqlexec.ERROR_UNSUPPORTED_STATEMENT, sql)
+	}
+}
+
+func TestStatementTables(t *testing.T) {
+	cases := []struct {
+		sql    string
+		tables []string
+	}{
+		{"select s.id from service s join api a on a.service_id=s.id where s.id in (select service_id from doc)", []string{"service", "api", "doc"}},
+		{"insert into curd.service (name) values('a')", []string{"curd.service"}},
+		{"update `api` set name='a'", []string{"api"}},
+		{"delete from service where id=1", []string{"service"}},
+		{"show tables", []string{}},
+	}
+	for _, c := range cases {
+		stmt, err := sqlexec.ParseStatement(c.sql)
+		require.NoError(t, err)
+		assert.Equal(t, c.tables, stmt.Tables(), c.sql)
+	}
+}
+
+func TestNormalizeSQL(t *testing.T) {
+	cases := map[string]string{
+		"select * from service where id=12 and name='a''b' and `t1`.x = \"c\\\"d\"": "select * from service where id=? and name=? and `t1`.x = ?",
+		"select  a1,\n\tb from t2 where v in (1.5, -3e2, 0x1f) limit 10":            "select a1, b from t2 where v in (?, -?, ?) limit ?",
+		"  update t set c = 'x' where id = ?  ":                                     "update t set c = ? where id = ?",
+		"select /* 'a' */ id from t -- id=1\n where id = 1 # x":                     "select id from t where id = ?",
+	}
+	for sqls, expected := range cases {
+		assert.Equal(t, expected, sqlexec.NormalizeSQL(sqls), sqls)
+	}
+}
+
+func TestExecOrQueryContextRoute(t *testing.T) {
+	db, _ := openFakeDB(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		return &fakeResponse{
+			columns:      []string{"id", "name"},
+			rows:         [][]driver.Value{{int64(1), []byte("a")}},
+			lastInsertId: 10,
+			rowsAffected: 1,
+		}, nil
+	})
+	ctx := context.Background()
+	cases := []struct {
+		sql string
+		out string
+	}{
+		{"select id,name from service", `[{"id":"1","name":"a"}]`},
+		{"show tables", `[{"id":"1","name":"a"}]`},
+		{"call list_service()", `[{"id":"1","name":"a"}]`},
+		{"replace into service (name) values('a')", `{"firstId":10,"insertedCount":1,"updatedCount":0,"ignoredCount":0,"ids":[10],"rowsAffected":1}`},
+		{"update service set name='a' where id=1", "1"},
+		{"create table t (id int)", "1"},
+		{"optimize table service", `[{"id":"1","name":"a"}]`},
+		{"set names utf8mb4", "1"},
+	}
+	for _, c := range cases {
+		out, err := sqlexec.ExecOrQueryContext(ctx, db, c.sql)
+		require.NoError(t, err, c.sql)
+		assert.Equal(t, c.out, out, c.sql)
+	}
+	_, err := sqlexec.ExecOrQueryContext(ctx, db, "commit")
+	require.ErrorIs(t, err, sqlexec.ERROR_UNSUPPORTED_STATEMENT)
+}
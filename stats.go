@@ -0,0 +1,141 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	context_Key_Stats contextKey = "sqlexec_stats"
+)
+
+// Stats executor 的连接池及语句执行统计,可直接序列化为json
+type Stats struct {
+	Connected        bool           `json:"connected"`          // 是否已建立连接池
+	Endpoint         string         `json:"endpoint,omitempty"` // 当前使用的主库地址(不含密码)
+	Pool             sql.DBStats    `json:"pool"`               // 主库连接池
+	Replicas         []HealthStatus `json:"replicas,omitempty"` // 从库健康状态及连接池
+	Queries          uint64         `json:"queries"`            // 执行的语句数,包括出错的语句
+	Errors           uint64         `json:"errors"`
+	SlowQueries      uint64         `json:"slowQueries"`       // 耗时超过慢语句阈值的语句数
+	SingleflightHits uint64         `json:"singleflightHits"`  // 合并查询时直接使用其它调用结果的次数
+	InFlight         int64          `json:"inFlight"`          // 正在执行的语句数
+	Rejected         uint64         `json:"rejected"`          // 被熔断器、并发限制拒绝的语句数,同时计入 Queries、Errors
+	Circuit          CircuitState   `json:"circuit,omitempty"` // 熔断器状态,未开启时为空
+}
+
+// executorStats 语句执行计数,通过ctx 传递给执行语句的函数
+type executorStats struct {
+	queries          atomic.Uint64
+	errors           atomic.Uint64
+	slowQueries      atomic.Uint64
+	singleflightHits atomic.Uint64
+	inFlight         atomic.Int64
+	rejected         atomic.Uint64
+}
+
+func withStats(ctx context.Context, stats *executorStats) context.Context {
+	return context.WithValue(ctx, context_Key_Stats, stats)
+}
+
+func statsFromContext(ctx context.Context) (stats *executorStats, ok bool) {
+	stats, ok = ctx.Value(context_Key_Stats).(*executorStats)
+	return stats, ok
+}
+
+// beginStatement 记录开始执行语句,返回的函数在语句结束时调用;ctx 中没有统计、指标记录器时不记录
+func beginStatement(ctx context.Context, call *StatementCall) (end func(err error, beginAt time.Time, endAt time.Time)) {
+	stats, ok := statsFromContext(ctx)
+	recorder, hasMetrics := metricsFromContext(ctx)
+	if !ok {
+		return func(err error, beginAt time.Time, endAt time.Time) {
+			if hasMetrics {
+				recorder.observe(call, endAt.Sub(beginAt), err)
+			}
+		}
+	}
+	stats.inFlight.Add(1)
+	return func(err error, beginAt time.Time, endAt time.Time) {
+		if hasMetrics {
+			recorder.observe(call, endAt.Sub(beginAt), err)
+		}
+		stats.inFlight.Add(-1)
+		stats.queries.Add(1)
+		if err != nil {
+			stats.errors.Add(1)
+		}
+		if isSlow(ctx, beginAt, endAt) {
+			stats.slowQueries.Add(1)
+		}
+	}
+}
+
+// addSingleflightHit 记录一次合并查询命中
+func addSingleflightHit(ctx context.Context) {
+	if stats, ok := statsFromContext(ctx); ok {
+		stats.singleflightHits.Add(1)
+	}
+}
+
+// addRejected 记录一次被熔断器、并发限制拒绝的语句
+func addRejected(ctx context.Context) {
+	if stats, ok := statsFromContext(ctx); ok {
+		stats.rejected.Add(1)
+	}
+}
+
+// Stats 连接池及语句执行统计,未连接时 Pool 为零值,不会触发连接
+func (e *ExecutorSQL) Stats() (stats Stats) {
+	stats = Stats{
+		Queries:          e.stats.queries.Load(),
+		Errors:           e.stats.errors.Load(),
+		SlowQueries:      e.stats.slowQueries.Load(),
+		SingleflightHits: e.stats.singleflightHits.Load(),
+		InFlight:         e.stats.inFlight.Load(),
+		Rejected:         e.stats.rejected.Load(),
+		Circuit:          e.CircuitState(),
+		Replicas:         e.ReplicaStatus(),
+	}
+	if db := e.connectedDB(); db != nil {
+		stats.Connected = true
+		stats.Pool = db.Stats()
+		stats.Endpoint = e.Endpoint()
+	}
+	return stats
+}
+
+// DBSnapshot 注册项最近一次检查的健康状态及当前统计
+type DBSnapshot struct {
+	Identity string       `json:"identity"`
+	Health   HealthStatus `json:"health"`
+	Stats    Stats        `json:"stats"`
+}
+
+// RegistrySnapshot 注册表中所有数据库的统计快照,用于管理接口输出
+type RegistrySnapshot struct {
+	CollectedAt time.Time    `json:"collectedAt"`
+	Databases   []DBSnapshot `json:"databases"`
+}
+
+// Snapshot 按标识顺序收集所有注册项的健康状态及统计,不会触发连接和健康检查
+func (r *Registry) Snapshot() (snapshot RegistrySnapshot) {
+	snapshot = RegistrySnapshot{
+		CollectedAt: time.Now().Local(),
+		Databases:   make([]DBSnapshot, 0),
+	}
+	r.Range(func(identity string, executor *ExecutorSQL) bool {
+		health, err := r.Status(identity)
+		if err != nil { // 收集过程中被移除
+			return true
+		}
+		snapshot.Databases = append(snapshot.Databases, DBSnapshot{
+			Identity: identity,
+			Health:   health,
+			Stats:    executor.Stats(),
+		})
+		return true
+	})
+	return snapshot
+}
@@ -0,0 +1,91 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestExecutorSQLStats(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	newFakeServer(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		switch {
+		case hasPrefixFold(query, "select missing"):
+			return nil, errors.New("unknown column")
+		case hasPrefixFold(query, "select blocking"):
+			<-release
+		}
+		return &fakeResponse{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), []byte("a")}}, rowsAffected: 1}, nil
+	})
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: t.Name(), MaxIdle: 2}, nil)
+	t.Cleanup(func() { executor.Close() })
+	stats := executor.Stats()
+	assert.False(t, stats.Connected)
+	assert.Zero(t, stats.Queries)
+
+	var out []map[string]string
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "select id,name from service", &out))
+	var rowsAffected int
+	require.NoError(t, executor.ExecOrQueryContext(sqlexec.WithSlowThreshold(ctx, time.Nanosecond), "update service set name='b'", &rowsAffected))
+	require.Error(t, executor.ExecOrQueryContext(ctx, "select missing from service", &out))
+	_, err := sqlexec.Query[struct{ ID int }](ctx, executor, "select id,name from service")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var out []map[string]string
+			assert.NoError(t, executor.ExecOrQueryContext(ctx, "select blocking,name from service", &out))
+		}()
+	}
+	assert.Eventually(t, func() bool { return executor.Stats().InFlight == 3 }, time.Second, 5*time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	stats = executor.Stats()
+	assert.True(t, stats.Connected)
+	assert.Equal(t, "endpoint-0", stats.Endpoint)
+	assert.Equal(t, uint64(7), stats.Queries)
+	assert.Equal(t, uint64(1), stats.Errors)
+	assert.Equal(t, uint64(1), stats.SlowQueries)
+	assert.Equal(t, uint64(2), stats.SingleflightHits)
+	assert.Zero(t, stats.InFlight)
+	assert.GreaterOrEqual(t, stats.Pool.OpenConnections, 1)
+}
+
+func TestRegistrySnapshot(t *testing.T) {
+	newFakeServer(t, t.Name(), nil)
+	registry := sqlexec.NewRegistry()
+	t.Cleanup(func() { registry.CloseAll() })
+	_, err := registry.Register("main", sqlexec.DBConfig{DSN: t.Name()}, nil)
+	require.NoError(t, err)
+	_, err = registry.Register("idle", sqlexec.DBConfig{DSN: t.Name()}, nil)
+	require.NoError(t, err)
+	_, err = registry.Check(context.Background(), "main")
+	require.NoError(t, err)
+
+	snapshot := registry.Snapshot()
+	require.Len(t, snapshot.Databases, 2)
+	assert.Equal(t, "idle", snapshot.Databases[0].Identity)
+	assert.False(t, snapshot.Databases[0].Stats.Connected)
+	assert.Equal(t, "main", snapshot.Databases[1].Identity)
+	assert.True(t, snapshot.Databases[1].Health.Healthy)
+	assert.True(t, snapshot.Databases[1].Stats.Connected)
+
+	b, err := json.Marshal(snapshot)
+	require.NoError(t, err)
+	var decoded sqlexec.RegistrySnapshot
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, snapshot.Databases[1].Stats.Pool.OpenConnections, decoded.Databases[1].Stats.Pool.OpenConnections)
+}
@@ -0,0 +1,148 @@
+package sqlexec
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// StreamFormat 流式输出格式
+type StreamFormat string
+
+const (
+	StreamFormat_JSON   StreamFormat = "json"   // 每个结果集输出一个json 数组并换行
+	StreamFormat_NDJSON StreamFormat = "ndjson" // 每行一个json 对象,多个结果集之间以空行分隔
+)
+
+// RowFn 逐行处理查询结果,resultSetIndex 为结果集序号(从0开始),返回错误时终止查询
+type RowFn func(resultSetIndex int, record map[string]any) (err error)
+
+// QueryEach 逐行读取查询结果并回调fn,不缓存结果,适合导出等大数据量查询
+func QueryEach(ctx context.Context, db *sql.DB, sqls string, fn RowFn, args ...any) (rowsAffected int64, err error) {
+	return queryEach(ctx, db, sqls, args, nil, fn)
+}
+
+// QueryStream 流式查询,按format 将结果逐行写入w
+func QueryStream(ctx context.Context, db *sql.DB, sqls string, w io.Writer, format StreamFormat, args ...any) (rowsAffected int64, err error) {
+	switch format {
+	case StreamFormat_JSON, StreamFormat_NDJSON:
+	default:
+		err = errors.Errorf("unsupported stream format: %s", format)
+		return 0, err
+	}
+	sw := &streamWriter{w: bufio.NewWriter(w), format: format}
+	rowsAffected, err = queryEach(ctx, db, sqls, args, sw.resultSet, sw.row)
+	if err != nil {
+		return rowsAffected, err
+	}
+	err = sw.w.Flush()
+	if err != nil {
+		return rowsAffected, err
+	}
+	return rowsAffected, nil
+}
+
+type streamWriter struct {
+	w        *bufio.Writer
+	format   StreamFormat
+	rowIndex int
+}
+
+func (sw *streamWriter) resultSet(resultSetIndex int, end bool) (err error) {
+	sw.rowIndex = 0
+	switch {
+	case sw.format == StreamFormat_JSON && end:
+		_, err = sw.w.WriteString("]\n")
+	case sw.format == StreamFormat_JSON:
+		_, err = sw.w.WriteString("[")
+	case sw.format == StreamFormat_NDJSON && !end && resultSetIndex > 0:
+		_, err = sw.w.WriteString("\n")
+	}
+	return err
+}
+
+func (sw *streamWriter) row(resultSetIndex int, record map[string]any) (err error) {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if sw.format == StreamFormat_JSON && sw.rowIndex > 0 {
+		b = append([]byte{','}, b...)
+	}
+	if sw.format == StreamFormat_NDJSON {
+		b = append(b, '\n')
+	}
+	sw.rowIndex++
+	_, err = sw.w.Write(b)
+	return err
+}
+
+func (e *ExecutorSQL) QueryEach(ctx context.Context, sqls string, fn RowFn, args ...any) (rowsAffected int64, err error) {
+	ctx = e.withExecutorContext(ctx)
+	ctx, _, _ = withParsedStatement(ctx, sqls)
+	err = e.withRoutedDB(ctx, sqls, false, func(ctx context.Context, db *sql.DB) (err error) { // 可能已输出部分数据,不能改用主库重试
+		rowsAffected, err = QueryEach(ctx, db, sqls, fn, args...)
+		return err
+	})
+	return rowsAffected, err
+}
+
+func (e *ExecutorSQL) QueryStream(ctx context.Context, sqls string, w io.Writer, format StreamFormat, args ...any) (rowsAffected int64, err error) {
+	ctx = e.withExecutorContext(ctx)
+	ctx, _, _ = withParsedStatement(ctx, sqls)
+	err = e.withRoutedDB(ctx, sqls, false, func(ctx context.Context, db *sql.DB) (err error) {
+		rowsAffected, err = QueryStream(ctx, db, sqls, w, format, args...)
+		return err
+	})
+	return rowsAffected, err
+}
+
+// queryEach 逐行扫描所有结果集,onResultSet 在每个结果集开始和结束时调用
+func queryEach(ctx context.Context, db *sql.DB, sqls string, args []any, onResultSet func(resultSetIndex int, end bool) error, fn RowFn) (rowsAffected int64, err error) {
+	mode := getResultMode(ctx)
+	return queryRows(ctx, db, sqls, args, func(rows *sql.Rows) (rowsAffected int64, err error) {
+		for resultSetIndex := 0; ; resultSetIndex++ {
+			scanner, err := newRowScanner(rows, mode)
+			if err != nil {
+				return rowsAffected, err
+			}
+			if onResultSet != nil {
+				if err = onResultSet(resultSetIndex, false); err != nil {
+					return rowsAffected, err
+				}
+			}
+			for rows.Next() {
+				record, err := scanner.scan(rows)
+				if err != nil {
+					return rowsAffected, err
+				}
+				rowsAffected++
+				if err = fn(resultSetIndex, record); err != nil {
+					return rowsAffected, err
+				}
+			}
+			if err = rows.Err(); err != nil {
+				return rowsAffected, err
+			}
+			if onResultSet != nil {
+				if err = onResultSet(resultSetIndex, true); err != nil {
+					return rowsAffected, err
+				}
+			}
+			if !rows.NextResultSet() {
+				break
+			}
+		}
+		return rowsAffected, rows.Err()
+	})
+}
+
+// queryRows 经过中间件执行查询,handle 负责读取行数据,返回读取的行数
+func queryRows(ctx context.Context, db *sql.DB, sqls string, args []any, handle func(rows *sql.Rows) (rowsAffected int64, err error)) (rowsAffected int64, err error) {
+	output, err := runStatement(ctx, db, CallKind_Rows, sqls, args, handle)
+	return output.RowsAffected, err
+}
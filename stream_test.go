@@ -0,0 +1,50 @@
+package sqlexec_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestQueryStream(t *testing.T) {
+	db, _ := openFakeDB(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		resp := &fakeResponse{
+			columns: []string{"id"},
+			types:   []string{"INT"},
+			rows:    [][]driver.Value{{int64(1)}, {int64(2)}},
+		}
+		if hasPrefixFold(query, "call") {
+			resp.next = &fakeResponse{columns: []string{"name"}, rows: [][]driver.Value{{[]byte("a")}}}
+		}
+		return resp, nil
+	})
+	ctx := sqlexec.WithResultMode(context.Background(), sqlexec.ResultMode_Typed)
+	t.Run("json", func(t *testing.T) {
+		var w bytes.Buffer
+		rowsAffected, err := sqlexec.QueryStream(ctx, db, "select id from service", &w, sqlexec.StreamFormat_JSON)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), rowsAffected)
+		assert.Equal(t, "[{\"id\":1},{\"id\":2}]\n", w.String())
+	})
+	t.Run("ndjson multi result set", func(t *testing.T) {
+		var w bytes.Buffer
+		rowsAffected, err := sqlexec.QueryStream(ctx, db, "call list_service()", &w, sqlexec.StreamFormat_NDJSON)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), rowsAffected)
+		assert.Equal(t, "{\"id\":1}\n{\"id\":2}\n\n{\"name\":\"a\"}\n", w.String())
+	})
+	t.Run("each", func(t *testing.T) {
+		ids := make([]any, 0)
+		_, err := sqlexec.QueryEach(ctx, db, "select id from service", func(resultSetIndex int, record map[string]any) error {
+			ids = append(ids, record["id"])
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []any{int64(1), int64(2)}, ids)
+	})
+}
@@ -0,0 +1,65 @@
+package sqlexec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	context_Key_StatementTimeout     contextKey = "sqlexec_statement_timeout"
+	context_Key_MaxExecutionTimeHint contextKey = "sqlexec_max_execution_time_hint"
+)
+
+// WithStatementTimeout 设置单条语句的超时时间,ctx 已有更早的截止时间时以ctx 为准,优先级高于 DBConfig.Timeout
+func WithStatementTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, context_Key_StatementTimeout, timeout)
+}
+
+func statementTimeoutFromContext(ctx context.Context) (timeout time.Duration, ok bool) {
+	timeout, ok = ctx.Value(context_Key_StatementTimeout).(time.Duration)
+	return timeout, ok
+}
+
+// WithMaxExecutionTimeHint 设置select 语句是否增加 /*+ MAX_EXECUTION_TIME(ms) */ 提示,由mysql 服务端按语句超时时间终止查询
+func WithMaxExecutionTimeHint(ctx context.Context, enable bool) context.Context {
+	return context.WithValue(ctx, context_Key_MaxExecutionTimeHint, enable)
+}
+
+func maxExecutionTimeHintFromContext(ctx context.Context) (enable bool, ok bool) {
+	enable, ok = ctx.Value(context_Key_MaxExecutionTimeHint).(bool)
+	return enable, ok
+}
+
+// withStatementTimeout 为语句设置超时,未设置超时时原样返回
+func withStatementTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout, _ := statementTimeoutFromContext(ctx)
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// withMaxExecutionTimeHint 开启提示且设置了语句超时时,为select 语句增加 MAX_EXECUTION_TIME 提示
+func withMaxExecutionTimeHint(ctx context.Context, sqls string) string {
+	enable, _ := maxExecutionTimeHintFromContext(ctx)
+	timeout, _ := statementTimeoutFromContext(ctx)
+	if !enable || timeout <= 0 {
+		return sqls
+	}
+	return AddMaxExecutionTimeHint(sqls, timeout)
+}
+
+// AddMaxExecutionTimeHint 在select 关键词后增加 /*+ MAX_EXECUTION_TIME(ms) */ 提示;非select 开头或已有该提示的语句原样返回
+func AddMaxExecutionTimeHint(sqls string, timeout time.Duration) string {
+	ms := timeout.Milliseconds()
+	if ms <= 0 || strings.Contains(strings.ToUpper(sqls), "MAX_EXECUTION_TIME") {
+		return sqls
+	}
+	keyword, end := firstKeywordEnd(sqls)
+	if keyword != "select" {
+		return sqls
+	}
+	return fmt.Sprintf("%s /*+ MAX_EXECUTION_TIME(%d) */%s", sqls[:end], ms, sqls[end:])
+}
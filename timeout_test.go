@@ -0,0 +1,78 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestAddMaxExecutionTimeHint(t *testing.T) {
+	cases := []struct {
+		sql  string
+		want string
+	}{
+		{"select * from service", "select /*+ MAX_EXECUTION_TIME(1500) */ * from service"},
+		{"/* list */ SELECT id from service", "/* list */ SELECT /*+ MAX_EXECUTION_TIME(1500) */ id from service"},
+		{"select /*+ MAX_EXECUTION_TIME(10) */ * from service", "select /*+ MAX_EXECUTION_TIME(10) */ * from service"},
+		{"update service set name='a'", "update service set name='a'"},
+		{"show tables", "show tables"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, sqlexec.AddMaxExecutionTimeHint(c.sql, 1500*time.Millisecond), c.sql)
+	}
+}
+
+func TestStatementTimeout(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeServer(t, t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		return &fakeResponse{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), []byte("a")}}, rowsAffected: 1}, nil
+	})
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: t.Name(), Timeout: 2, MaxExecutionTimeHint: true}, nil)
+	t.Cleanup(func() { executor.Close() })
+	var out []map[string]string
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "select id,name from service", &out))
+	var rowsAffected int
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "update service set name='a'", &rowsAffected))
+	assert.Equal(t, []string{"select /*+ MAX_EXECUTION_TIME(2000) */ id,name from service", "update service set name='a'"}, server.Log())
+
+	shortCtx := sqlexec.WithStatementTimeout(ctx, time.Nanosecond)
+	_, _, err := sqlexec.Exec(shortCtx, executor, "update service set name='a'")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = sqlexec.QueryContext(shortCtx, mustGetDB(t, executor), "select id,name from service")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestLogLevelAllow(t *testing.T) {
+	cases := []struct {
+		level    sqlexec.LogLevel
+		hasError bool
+		slow     bool
+		want     bool
+	}{
+		{"", false, false, true},
+		{sqlexec.LogLevel_All, false, false, true},
+		{sqlexec.LogLevel_Silent, true, true, false},
+		{sqlexec.LogLevel_Error, false, true, false},
+		{sqlexec.LogLevel_Error, true, false, true},
+		{sqlexec.LogLevel_Slow, false, false, false},
+		{sqlexec.LogLevel_Slow, false, true, true},
+		{sqlexec.LogLevel_Slow, true, false, true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, c.level.Allow(c.hasError, c.slow), "%s error:%v slow:%v", c.level, c.hasError, c.slow)
+	}
+	err := sqlexec.DBConfig{DSN: "dsn", LogLevel: "debug"}.Validate()
+	require.Error(t, err)
+}
+
+func mustGetDB(t *testing.T, executor *sqlexec.ExecutorSQL) (db *sql.DB) {
+	db, err := executor.GetDB()
+	require.NoError(t, err)
+	return db
+}
@@ -0,0 +1,96 @@
+package sqlexec
+
+import (
+	"context"
+)
+
+const (
+	context_Key_Tracer contextKey = "sqlexec_tracer"
+)
+
+// SpanInfo 语句开始执行时的追踪信息
+type SpanInfo struct {
+	System    string   // 数据库类型,固定为 mysql
+	DBName    string   // 库名,通过 ExecutorSQL 执行时从配置获取,否则为 WithDBName 设置的值
+	Statement string   // NormalizeSQL 规范化后的语句,不含参数值
+	Operation string   // 语句类型,无法识别的语句为首个关键词
+	Tables    []string // 语句涉及的表
+	TxID      string   // 所属事务ID,非事务为空
+}
+
+// SpanResult 语句执行结果
+type SpanResult struct {
+	RowsAffected int64
+	Err          error
+}
+
+// Span 一次语句执行的追踪
+type Span interface {
+	End(result SpanResult)
+}
+
+// Tracer 语句追踪接口,StartSpan 返回的ctx 用于执行语句,父span 从传入的ctx 获取;
+// OpenTelemetry 适配见 otelsqlexec 包
+type Tracer interface {
+	StartSpan(ctx context.Context, info SpanInfo) (context.Context, Span)
+}
+
+// tracing ctx 中的追踪器
+type tracing struct {
+	tracer Tracer
+}
+
+// WithTracer 设置本次调用的追踪器,优先级高于 ExecutorSQL.SetTracer
+func WithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, context_Key_Tracer, &tracing{tracer: tracer})
+}
+
+func tracingFromContext(ctx context.Context) (t *tracing, ok bool) {
+	t, ok = ctx.Value(context_Key_Tracer).(*tracing)
+	return t, ok && t.tracer != nil
+}
+
+type noopSpan struct{}
+
+func (noopSpan) End(result SpanResult) {}
+
+// startSpan 开始语句追踪,ctx 中没有追踪器时返回原ctx 和空span
+func startSpan(ctx context.Context, call *StatementCall) (context.Context, Span) {
+	t, ok := tracingFromContext(ctx)
+	if !ok {
+		return ctx, noopSpan{}
+	}
+	info := SpanInfo{
+		System:    "mysql",
+		DBName:    call.DBName,
+		Statement: NormalizeSQL(call.SQL),
+		Operation: string(call.Type),
+		Tables:    call.Tables,
+		TxID:      call.TxID,
+	}
+	if info.Operation == "" {
+		info.Operation = firstKeyword(call.SQL)
+	}
+	return t.tracer.StartSpan(ctx, info)
+}
+
+// SetTracer 设置追踪器,通过 executor 执行的每条语句生成一个span;单次调用可通过 WithTracer 覆盖
+func (e *ExecutorSQL) SetTracer(tracer Tracer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tracer = tracer
+}
+
+// withTracing 将 executor 的追踪器写入ctx
+func (e *ExecutorSQL) withTracing(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(context_Key_Tracer).(*tracing); ok {
+		return ctx
+	}
+	e.mu.Lock()
+	tracer := e.tracer
+	e.mu.Unlock()
+	if tracer == nil {
+		return ctx
+	}
+	return WithTracer(ctx, tracer)
+}
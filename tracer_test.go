@@ -0,0 +1,88 @@
+package sqlexec_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+type parentKey struct{}
+
+// recordingTracer 记录span 信息及结果
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+type recordingSpan struct {
+	info   sqlexec.SpanInfo
+	parent any
+	result *sqlexec.SpanResult
+}
+
+func (t *recordingTracer) StartSpan(ctx context.Context, info sqlexec.SpanInfo) (context.Context, sqlexec.Span) {
+	span := &recordingSpan{info: info, parent: ctx.Value(parentKey{})}
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return ctx, span
+}
+
+func (s *recordingSpan) End(result sqlexec.SpanResult) {
+	s.result = &result
+}
+
+func TestExecutorSQLTracer(t *testing.T) {
+	newFakeServer(t, "root:123@tcp(127.0.0.1:3306)/curd"+t.Name(), func(query string, args []driver.NamedValue) (*fakeResponse, error) {
+		if hasPrefixFold(query, "delete") {
+			return nil, errors.New("denied")
+		}
+		return &fakeResponse{columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), []byte("a")}, {int64(2), []byte("b")}}, rowsAffected: 3}, nil
+	})
+	tracer := &recordingTracer{}
+	executor := sqlexec.NewExecutorSQL(sqlexec.DBConfig{DSN: "root:123@tcp(127.0.0.1:3306)/curd" + t.Name()}, nil)
+	executor.SetTracer(tracer)
+	t.Cleanup(func() { executor.Close() })
+	ctx := context.WithValue(context.Background(), parentKey{}, "parent")
+
+	var out []map[string]string
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "select id,name from service where name='secret'", &out))
+	var rowsAffected int
+	require.NoError(t, executor.ExecOrQueryContext(ctx, "update service set name='b' where id=1", &rowsAffected))
+	require.Error(t, executor.ExecOrQueryContext(ctx, "delete from service where id=1", &rowsAffected))
+
+	require.Len(t, tracer.spans, 3)
+	query := tracer.spans[0]
+	assert.Equal(t, sqlexec.SpanInfo{
+		System:    "mysql",
+		DBName:    "curd" + t.Name(),
+		Statement: "select id,name from service where name=?",
+		Operation: "select",
+		Tables:    []string{"service"},
+	}, query.info)
+	assert.Equal(t, "parent", query.parent)
+	require.NotNil(t, query.result)
+	assert.Equal(t, int64(2), query.result.RowsAffected)
+	assert.NoError(t, query.result.Err)
+
+	assert.Equal(t, "update", tracer.spans[1].info.Operation)
+	assert.Equal(t, int64(3), tracer.spans[1].result.RowsAffected)
+	assert.Error(t, tracer.spans[2].result.Err)
+
+	other := &recordingTracer{} // ctx 中的追踪器优先
+	require.NoError(t, executor.ExecOrQueryContext(sqlexec.WithTracer(ctx, other), "select id,name from service", &out))
+	require.Len(t, other.spans, 1)
+	assert.Equal(t, "curd"+t.Name(), other.spans[0].info.DBName)
+	assert.Len(t, tracer.spans, 3)
+
+	cte := &recordingTracer{} // 操作名、表名取自解析后的语句
+	require.NoError(t, executor.ExecOrQueryContext(sqlexec.WithTracer(ctx, cte), "with t as (select id from service) update service set name='b' where id in (select id from t)", &rowsAffected))
+	require.Len(t, cte.spans, 1)
+	assert.Equal(t, "update", cte.spans[0].info.Operation)
+}
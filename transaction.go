@@ -0,0 +1,211 @@
+package sqlexec
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type contextKey string
+
+const (
+	context_Key_Transaction contextKey = "sqlexec_transaction"
+	context_Key_Conn        contextKey = "sqlexec_conn"
+)
+
+// sqlExecutor *sql.DB 和 *sql.Tx 共同的执行方法
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// Transaction 通过context 传递的事务，同一个db 在闭包内的sqlexec 调用都会使用该事务
+type Transaction struct {
+	ID           string
+	db           *sql.DB
+	tx           *sql.Tx
+	executor     *ExecutorSQL // 通过 ExecutorSQL.WithTransaction 开启时为该executor,其语句只在事务中执行
+	savepointSeq int64
+}
+
+func (t *Transaction) Tx() *sql.Tx {
+	return t.tx
+}
+
+var transactionSeq int64
+
+func newTransactionID() string {
+	seq := atomic.AddInt64(&transactionSeq, 1)
+	return fmt.Sprintf("%x-%d", time.Now().UnixNano(), seq)
+}
+
+// TransactionFromContext 获取context 中绑定到db 的事务
+func TransactionFromContext(ctx context.Context, db *sql.DB) (transaction *Transaction, ok bool) {
+	transaction, ok = ctx.Value(context_Key_Transaction).(*Transaction)
+	if !ok || transaction.db != db {
+		return nil, false
+	}
+	return transaction, true
+}
+
+// pinnedConn 固定的连接,同一个db 在ctx 内的调用(包括开启事务)都使用该连接
+type pinnedConn struct {
+	db    *sql.DB
+	conn  *sql.Conn
+	dirty bool // 执行过 use 等修改会话状态的语句,释放时丢弃连接,不放回连接池
+}
+
+func withPinnedConn(ctx context.Context, pinned *pinnedConn) context.Context {
+	return context.WithValue(ctx, context_Key_Conn, pinned)
+}
+
+func pinnedConnFromContext(ctx context.Context, db *sql.DB) (pinned *pinnedConn, ok bool) {
+	pinned, ok = ctx.Value(context_Key_Conn).(*pinnedConn)
+	if !ok || pinned.db != db {
+		return nil, false
+	}
+	return pinned, true
+}
+
+// pinConn ctx 中没有db 的事务和固定连接时从连接池取出一个连接固定到ctx,release 归还该连接
+func pinConn(ctx context.Context, db *sql.DB) (pinnedCtx context.Context, release func(), err error) {
+	_, inTransaction := TransactionFromContext(ctx, db) // 事务中的语句已在同一个连接上执行
+	if _, ok := pinnedConnFromContext(ctx, db); ok || inTransaction {
+		return ctx, func() {}, nil
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		recordConnFailure(ctx, db, err)
+		return ctx, nil, err
+	}
+	pinned := &pinnedConn{db: db, conn: conn}
+	return withPinnedConn(ctx, pinned), pinned.release, nil
+}
+
+// release 归还连接,dirty 时关闭连接
+func (p *pinnedConn) release() {
+	if p.dirty {
+		_ = p.conn.Raw(func(driverConn any) error {
+			return driver.ErrBadConn // 返回 ErrBadConn 时 database/sql 关闭该连接
+		})
+	}
+	_ = p.conn.Close()
+}
+
+// getSQLExecutor context 中存在db 的事务时使用事务，存在固定的连接时使用该连接，否则使用db
+func getSQLExecutor(ctx context.Context, db *sql.DB) (executor sqlExecutor, txID string) {
+	transaction, ok := TransactionFromContext(ctx, db)
+	if ok {
+		return transaction.tx, transaction.ID
+	}
+	if pinned, ok := pinnedConnFromContext(ctx, db); ok {
+		return pinned.conn, ""
+	}
+	return db, ""
+}
+
+// WithTransaction 开启事务并存入context,fn 返回错误或者panic 时回滚，否则提交;context 中已存在该db 的事务时，使用SAVEPOINT 实现嵌套事务
+func WithTransaction(ctx context.Context, db *sql.DB, fn func(ctx context.Context) error) (err error) {
+	return withTransaction(ctx, db, nil, fn)
+}
+
+func withTransaction(ctx context.Context, db *sql.DB, executor *ExecutorSQL, fn func(ctx context.Context) error) (err error) {
+	if parent, ok := TransactionFromContext(ctx, db); ok {
+		return parent.withSavepoint(ctx, fn)
+	}
+	transaction := &Transaction{
+		ID:       newTransactionID(),
+		db:       db,
+		executor: executor,
+	}
+	beginLog := &LogInfoEXECSQL{SQL: "BEGIN", TxID: transaction.ID, BeginAt: time.Now().Local()}
+	if pinned, ok := pinnedConnFromContext(ctx, db); ok {
+		transaction.tx, err = pinned.conn.BeginTx(ctx, nil)
+	} else {
+		transaction.tx, err = db.BeginTx(ctx, nil)
+	}
+	beginLog.EndAt = time.Now().Local()
+	beginLog.Err = err
+	sendLogInfoEXECSQL(ctx, beginLog)
+	if err != nil {
+		recordConnFailure(ctx, db, err)
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			transaction.rollback(ctx)
+			panic(r)
+		}
+		if err != nil {
+			transaction.rollback(ctx)
+			return
+		}
+		err = transaction.commit(ctx)
+	}()
+	txCtx := context.WithValue(ctx, context_Key_Transaction, transaction)
+	err = fn(txCtx)
+	return err
+}
+
+// withSavepoint 嵌套事务,fn 返回错误或者panic 时回滚到保存点,否则释放保存点,由最外层事务决定提交或回滚
+func (t *Transaction) withSavepoint(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	savepoint := fmt.Sprintf("sp_%d", atomic.AddInt64(&t.savepointSeq, 1))
+	err = t.exec(ctx, fmt.Sprintf("SAVEPOINT %s", savepoint))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			_ = t.exec(ctx, fmt.Sprintf("ROLLBACK TO SAVEPOINT %s", savepoint))
+			panic(r)
+		}
+		if err != nil {
+			_ = t.exec(ctx, fmt.Sprintf("ROLLBACK TO SAVEPOINT %s", savepoint))
+			return
+		}
+		err = t.exec(ctx, fmt.Sprintf("RELEASE SAVEPOINT %s", savepoint))
+	}()
+	err = fn(ctx)
+	return err
+}
+
+// exec 执行事务控制语句并记录日志
+func (t *Transaction) exec(ctx context.Context, sqls string) (err error) {
+	logInfo := &LogInfoEXECSQL{SQL: sqls, TxID: t.ID, BeginAt: time.Now().Local()}
+	_, err = t.tx.ExecContext(ctx, sqls)
+	logInfo.EndAt = time.Now().Local()
+	logInfo.Err = err
+	sendLogInfoEXECSQL(ctx, logInfo)
+	if err != nil {
+		recordConnFailure(ctx, t.db, err)
+		err = errors.WithMessagef(err, "transaction:%s", t.ID)
+		return err
+	}
+	return nil
+}
+
+func (t *Transaction) commit(ctx context.Context) (err error) {
+	logInfo := &LogInfoEXECSQL{SQL: "COMMIT", TxID: t.ID, BeginAt: time.Now().Local()}
+	err = t.tx.Commit()
+	logInfo.EndAt = time.Now().Local()
+	logInfo.Err = err
+	sendLogInfoEXECSQL(ctx, logInfo)
+	if err != nil {
+		recordConnFailure(ctx, t.db, err)
+		err = errors.WithMessagef(err, "commit transaction:%s", t.ID)
+		return err
+	}
+	return nil
+}
+
+func (t *Transaction) rollback(ctx context.Context) {
+	logInfo := &LogInfoEXECSQL{SQL: "ROLLBACK", TxID: t.ID, BeginAt: time.Now().Local()}
+	logInfo.Err = t.tx.Rollback()
+	logInfo.EndAt = time.Now().Local()
+	sendLogInfoEXECSQL(ctx, logInfo)
+}
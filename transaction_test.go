@@ -0,0 +1,88 @@
+package sqlexec_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suifengpiao14/sqlexec"
+)
+
+func TestWithTransaction(t *testing.T) {
+	ctx := context.Background()
+	t.Run("commit", func(t *testing.T) {
+		db, server := openFakeDB(t, t.Name(), nil)
+		err := sqlexec.WithTransaction(ctx, db, func(ctx context.Context) error {
+			_, ok := sqlexec.TransactionFromContext(ctx, db)
+			require.True(t, ok)
+			_, _, err := sqlexec.ExecContext(ctx, db, "update service set name='a' where id=1")
+			return err
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"BEGIN", "update service set name='a' where id=1", "COMMIT"}, server.Log())
+	})
+	t.Run("rollback on error", func(t *testing.T) {
+		db, server := openFakeDB(t, t.Name(), nil)
+		errBiz := errors.New("biz error")
+		err := sqlexec.WithTransaction(ctx, db, func(ctx context.Context) error {
+			_, _, err := sqlexec.ExecContext(ctx, db, "delete from service where id=1")
+			require.NoError(t, err)
+			return errBiz
+		})
+		require.ErrorIs(t, err, errBiz)
+		assert.Equal(t, []string{"BEGIN", "delete from service where id=1", "ROLLBACK"}, server.Log())
+	})
+	t.Run("rollback on panic", func(t *testing.T) {
+		db, server := openFakeDB(t, t.Name(), nil)
+		assert.Panics(t, func() {
+			_ = sqlexec.WithTransaction(ctx, db, func(ctx context.Context) error {
+				panic("boom")
+			})
+		})
+		assert.Equal(t, []string{"BEGIN", "ROLLBACK"}, server.Log())
+	})
+	t.Run("other db not in transaction", func(t *testing.T) {
+		db, _ := openFakeDB(t, t.Name(), nil)
+		other, otherServer := openFakeDB(t, t.Name()+"_other", nil)
+		err := sqlexec.WithTransaction(ctx, db, func(ctx context.Context) error {
+			_, ok := sqlexec.TransactionFromContext(ctx, other)
+			assert.False(t, ok)
+			_, _, err := sqlexec.ExecContext(ctx, other, "update service set name='b' where id=2")
+			return err
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"update service set name='b' where id=2"}, otherServer.Log())
+	})
+}
+
+func TestNestedTransaction(t *testing.T) {
+	ctx := context.Background()
+	t.Run("release", func(t *testing.T) {
+		db, server := openFakeDB(t, t.Name(), nil)
+		err := sqlexec.WithTransaction(ctx, db, func(ctx context.Context) error {
+			return sqlexec.WithTransaction(ctx, db, func(ctx context.Context) error {
+				_, _, err := sqlexec.ExecContext(ctx, db, "update service set name='a' where id=1")
+				return err
+			})
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"BEGIN", "SAVEPOINT sp_1", "update service set name='a' where id=1", "RELEASE SAVEPOINT sp_1", "COMMIT"}, server.Log())
+	})
+	t.Run("rollback to savepoint", func(t *testing.T) {
+		db, server := openFakeDB(t, t.Name(), nil)
+		errBiz := errors.New("biz error")
+		err := sqlexec.WithTransaction(ctx, db, func(ctx context.Context) error {
+			err := sqlexec.WithTransaction(ctx, db, func(ctx context.Context) error {
+				return errBiz
+			})
+			require.ErrorIs(t, err, errBiz)
+			return sqlexec.WithTransaction(ctx, db, func(ctx context.Context) error {
+				return nil
+			})
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"BEGIN", "SAVEPOINT sp_1", "ROLLBACK TO SAVEPOINT sp_1", "SAVEPOINT sp_2", "RELEASE SAVEPOINT sp_2", "COMMIT"}, server.Log())
+	})
+}